@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// prefectures are prefectures of Japan.
+var prefectures = []string{
+	"北海道", "青森県", "岩手県", "宮城県", "秋田県", "山形県", "福島県",
+	"茨城県", "栃木県", "群馬県", "埼玉県", "千葉県", "東京都", "神奈川県",
+	"新潟県", "富山県", "石川県", "福井県", "山梨県", "長野県", "岐阜県",
+	"静岡県", "愛知県", "三重県", "滋賀県", "京都府", "大阪府", "兵庫県",
+	"奈良県", "和歌山県", "鳥取県", "島根県", "岡山県", "広島県", "山口県",
+	"徳島県", "香川県", "愛媛県", "高知県", "福岡県", "佐賀県", "長崎県",
+	"熊本県", "大分県", "宮崎県", "鹿児島県", "沖縄県",
+}
+
+var (
+	postalCodeRegexp        = regexp.MustCompile(`^\d{3}-\d{4}$`)
+	addressPostalCodeRegexp = regexp.MustCompile(`^〒?\s*([0-9０-９]{3})[-－]?([0-9０-９]{4})\s*`)
+	// a city is a city, a ward of Tokyo, or a town or a village of a
+	// district. A ward of a designated city is a part of the city. Names of
+	// them don't have digits.
+	addressCityRegexp = regexp.MustCompile(`^([^\s0-9０-９]+?郡[^\s0-9０-９]+?[町村]|` +
+		`[^\s0-9０-９]+?市([^\s0-9０-９]{1,4}?区)?|[^\s0-9０-９]+?区|[^\s0-9０-９]+?[町村])`)
+)
+
+// Address is a postal address of a gallery in Japan.
+type Address struct {
+	PostalCode string `json:"postal_code"`
+	Prefecture string `json:"prefecture"`
+	City       string `json:"city"`
+	Street     string `json:"street"`
+}
+
+// UnmarshalJSON accepts an object or a string of a whole address such as
+// "070-0032 旭川市２条通８丁目".
+func (a *Address) UnmarshalJSON(b []byte) error {
+	if len(b) != 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*a = ParseAddress(s)
+		return nil
+	}
+	// avoid recursion
+	type address Address
+	return json.Unmarshal(b, (*address)(a))
+}
+
+func (a Address) String() string {
+	s := a.Prefecture + a.City + a.Street
+	if a.PostalCode != "" {
+		s = "〒" + a.PostalCode + " " + s
+	}
+	return s
+}
+
+// ParseAddress splits an address into a postal code, a prefecture, a city
+// and the rest. Parts that are not found are empty.
+func ParseAddress(s string) (a Address) {
+	s = strings.TrimSpace(s)
+	if m := addressPostalCodeRegexp.FindStringSubmatch(s); m != nil {
+		a.PostalCode = normalizeDigits(m[1] + "-" + m[2])
+		s = s[len(m[0]):]
+	}
+	for _, p := range prefectures {
+		if strings.HasPrefix(s, p) {
+			a.Prefecture = p
+			s = s[len(p):]
+			break
+		}
+	}
+	if m := addressCityRegexp.FindString(s); m != "" && m != s {
+		a.City = m
+		s = s[len(m):]
+	}
+	a.Street = strings.TrimSpace(s)
+	return
+}
+
+// normalizeDigits converts full width digits into ASCII.
+func normalizeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '０' && r <= '９' {
+			return '0' + r - '０'
+		}
+		return r
+	}, s)
+}
+
+// Validate returns errors of the postal code and the prefecture.
+func (a *Address) Validate() (err ValidationError) {
+	if a.PostalCode != "" && !postalCodeRegexp.MatchString(a.PostalCode) {
+		err = err.Append(fmt.Sprintf(
+			"Invalid postal_code: %s should be like 070-0032", a.PostalCode))
+	}
+	if a.Prefecture != "" && stringIndex(prefectures, a.Prefecture) == -1 {
+		err = err.Append(fmt.Sprintf(
+			"Invalid prefecture: %s is not a prefecture", a.Prefecture))
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	for _, c := range []struct {
+		s        string
+		expected Address
+	}{
+		{"070-0032 旭川市２条通８丁目",
+			Address{"070-0032", "", "旭川市", "２条通８丁目"}},
+		{"〒０７０－００３２ 北海道旭川市２条通８丁目",
+			Address{"070-0032", "北海道", "旭川市", "２条通８丁目"}},
+		{"東京都中央区銀座1-2-3",
+			Address{"", "東京都", "中央区", "銀座1-2-3"}},
+		{"神奈川県横浜市中区山下町1",
+			Address{"", "神奈川県", "横浜市中区", "山下町1"}},
+		{"北海道上川郡東川町1",
+			Address{"", "北海道", "上川郡東川町", "1"}},
+		{"旭川", Address{"", "", "", "旭川"}},
+	} {
+		if a := ParseAddress(c.s); a != c.expected {
+			t.Fatalf("%s: Expected %#v. But got %#v instead", c.s,
+				c.expected, a)
+		}
+	}
+}
+
+func TestAddressUnmarshaling(t *testing.T) {
+	expected := Address{"070-0032", "北海道", "旭川市", "２条通８丁目"}
+	for _, b := range []string{
+		`"070-0032 北海道旭川市２条通８丁目"`,
+		`{"postal_code": "070-0032", "prefecture": "北海道",
+			"city": "旭川市", "street": "２条通８丁目"}`,
+	} {
+		var a Address
+		if err := json.Unmarshal([]byte(b), &a); err != nil {
+			t.Fatal(err)
+		}
+		if a != expected {
+			t.Fatalf("Expected %#v. But got %#v instead", expected, a)
+		}
+	}
+}
+
+func TestAddressValidate(t *testing.T) {
+	a := &Address{PostalCode: "0700032", Prefecture: "北海"}
+	err := a.Validate()
+	if len(err) != 2 {
+		t.Fatalf("Expected 2 errors. But got %v", err)
+	}
+	a = &Address{"070-0032", "北海道", "旭川市", ""}
+	if err := a.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
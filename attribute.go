@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonKeys returns JSON keys of fields of a struct.
+func jsonKeys(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	keys := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur := row[j]
+			row[j] = min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev = cur
+		}
+	}
+	return row[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggest returns the known key closest to key, or empty if nothing is close
+// enough. Keys are compared case insensitively.
+func suggest(key string, known []string) string {
+	best, bestDistance := "", 0
+	lower := strings.ToLower(key)
+	for _, k := range known {
+		d := levenshtein(lower, k)
+		if best == "" || d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	// allow a typo for short keys and two for longer ones
+	limit := 1
+	if len(key) > 4 {
+		limit = 2
+	}
+	if best == "" || bestDistance > limit {
+		return ""
+	}
+	return best
+}
+
+// unknownAttributes returns warnings of keys of obj that are not in known.
+// Keys are compared case insensitively as json.Unmarshal matches them.
+func unknownAttributes(obj map[string]json.RawMessage, known []string, of string) []string {
+	keys := []string{}
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, k := range keys {
+		if knownKey(known, k) {
+			continue
+		}
+		msg := fmt.Sprintf("Unknown attribute %q", k)
+		if of != "" {
+			msg += " of " + of
+		}
+		if s := suggest(k, known); s != "" {
+			msg += fmt.Sprintf(". Did you mean %q?", s)
+		}
+		warnings = append(warnings, msg)
+	}
+	return warnings
+}
+
+// knownKey reports whether key is in known case insensitively.
+func knownKey(known []string, key string) bool {
+	for _, k := range known {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringIndex(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckGalleryAttributes returns warnings of unknown attributes of gallery
+// JSON and its exhibition file objects, with suggestions of known attributes
+// that are similar. It returns nil if b is not a JSON object.
+func CheckGalleryAttributes(b []byte) []string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil
+	}
+	warnings := unknownAttributes(obj, jsonKeys(galleryInput{}), "")
+
+	var files []json.RawMessage
+	if err := json.Unmarshal(obj["exhibitions"], &files); err != nil {
+		return warnings
+	}
+	fileKeys := jsonKeys(ExhibitionFile{})
+	for i, f := range files {
+		var fileObj map[string]json.RawMessage
+		if err := json.Unmarshal(f, &fileObj); err != nil {
+			continue
+		}
+		warnings = append(warnings, unknownAttributes(fileObj, fileKeys,
+			fmt.Sprintf("exhibitions[%d]", i))...)
+	}
+	return warnings
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"address", "address", 0},
+		{"adress", "address", 1},
+		{"closed_on", "close_on", 1},
+		{"kitten", "sitting", 3},
+		{"画廊", "画廊名", 1},
+	}
+	for _, c := range cases {
+		if d := levenshtein(c.a, c.b); d != c.expected {
+			t.Fatalf("%s, %s: Expected %d. But got %d instead", c.a, c.b,
+				c.expected, d)
+		}
+	}
+}
+
+func TestCheckGalleryAttributes(t *testing.T) {
+	b := []byte(`{
+		"id": "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		"name": "ヒラマ画廊",
+		"adress": "070-0032 旭川市２条通８丁目",
+		"opens_at": "10:00",
+		"Open_At": "10:00",
+		"website": "http://example.com",
+		"exhibitions": [
+			"2013.csv",
+			{"file": "2014.csv", "encodng": "shift_jis"}
+		]
+	}`)
+	expected := []string{
+		`Unknown attribute "adress". Did you mean "address"?`,
+		`Unknown attribute "opens_at". Did you mean "open_at"?`,
+		`Unknown attribute "website"`,
+		`Unknown attribute "encodng" of exhibitions[1]. Did you mean "encoding"?`,
+	}
+	if warnings := CheckGalleryAttributes(b); !reflect.DeepEqual(expected, warnings) {
+		t.Fatalf("Expected %q\n. But got %q instead", expected, warnings)
+	}
+
+	b = []byte(`{"id": "a", "name": "b", "exhibitions": ["2014.csv"]}`)
+	if warnings := CheckGalleryAttributes(b); warnings != nil {
+		t.Fatalf("It should return nil. But got %q", warnings)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ImportResult is a result of importing a gallery JSON.
+type ImportResult struct {
+	Name     string
+	Diff     *GalleryDiff
+	Err      error
+	Duration time.Duration
+}
+
+// isGalleryJSON reports whether b is a JSON object that has "id" and
+// "exhibitions".
+func isGalleryJSON(b []byte) bool {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return false
+	}
+	_, hasId := m["id"]
+	_, hasExhibitions := m["exhibitions"]
+	return hasId && hasExhibitions
+}
+
+// FindGalleries expands targets into a list of gallery JSON files and URLs.
+// Directories are walked recursively and every gallery JSON in them is
+// included. Other targets are included as they are.
+func FindGalleries(targets []string) ([]string, error) {
+	names := []string{}
+	for _, target := range targets {
+		if isURL(target) {
+			names = append(names, target)
+			continue
+		}
+		fi, err := os.Stat(target)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			names = append(names, target)
+			continue
+		}
+		err = filepath.Walk(target, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() || filepath.Ext(name) != ".json" {
+				return nil
+			}
+			b, err := ioutil.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			if isGalleryJSON(b) {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// ImportName imports a gallery JSON file or URL.
+func (im *Importer) ImportName(name string) (*GalleryDiff, error) {
+	if isURL(name) {
+		return im.ImportGallery(name)
+	}
+	return im.ImportFixture(name)
+}
+
+// ImportAll imports galleries concurrently by the given number of workers.
+// A failure of a gallery doesn't stop importing others. Results are in the
+// same order as names.
+func (im *Importer) ImportAll(names []string, workers int) []*ImportResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]*ImportResult, len(names))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				start := time.Now()
+				r := &ImportResult{Name: names[j]}
+				r.Diff, r.Err = im.ImportName(names[j])
+				r.Duration = time.Since(start)
+				results[j] = r
+			}
+		}()
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// WriteSummary writes a line for each result and the total counts. It
+// returns the number of failures.
+func WriteSummary(w io.Writer, results []*ImportResult) (failed int) {
+	var imported, skipped int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed += 1
+		case r.Diff.Skipped:
+			skipped += 1
+		default:
+			imported += 1
+		}
+		writeResult(w, r)
+	}
+	fmt.Fprintf(w, "%d galleries: %d imported, %d skipped, %d failed\n",
+		len(results), imported, skipped, failed)
+	return
+}
+
+// writeResult writes a line of a result followed by lines of warnings.
+func writeResult(w io.Writer, r *ImportResult) {
+	switch {
+	case r.Err != nil:
+		fmt.Fprintf(w, "FAIL %s: %s\n", r.Name, r.Err.Error())
+		return
+	case r.Diff.Skipped:
+		fmt.Fprintf(w, "SKIP %s %s: unchanged\n", r.Name, r.Diff.GalleryId)
+	default:
+		d := r.Diff
+		fmt.Fprintf(w, "OK   %s %s: %d created, %d changed, %d removed, "+
+			"%d unchanged, %d kept (%s)\n", r.Name, d.GalleryId,
+			len(d.Created), len(d.Changed), len(d.Removed), d.Unchanged,
+			d.Kept, r.Duration)
+	}
+	for _, warning := range r.Diff.Warnings {
+		fmt.Fprintf(w, "WARN %s: %s\n", r.Name, warning)
+	}
+}
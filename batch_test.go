@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindGalleries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"hirama/hirama.json":    `{"id": "a", "exhibitions": []}`,
+		"hirama/2014.csv":       hiramaCSV,
+		"hirama/2015.json":      `[{"id": "2015-1"}]`,
+		"tokyo/ginza/foo.json":  `{"id": "b", "exhibitions": ["2014.csv"]}`,
+		"tokyo/ginza/meta.json": `{"id": "c"}`,
+		"broken.json":           `{"id": `,
+	}
+	for name, data := range files {
+		name = path.Join(dir, name)
+		if err = os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := FindGalleries([]string{
+		dir,
+		path.Join(dir, "tokyo/ginza/meta.json"),
+		"http://example.com/gallery.json",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		path.Join(dir, "hirama/hirama.json"),
+		path.Join(dir, "tokyo/ginza/foo.json"),
+		path.Join(dir, "tokyo/ginza/meta.json"),
+		"http://example.com/gallery.json",
+	}
+	if !reflect.DeepEqual(expected, names) {
+		t.Fatalf("Expected %v. But got %v instead", expected, names)
+	}
+
+	if _, err = FindGalleries([]string{path.Join(dir, "nothing")}); err == nil {
+		t.Fatal("It should return an error with a missing file")
+	}
+}
+
+func TestImportAllContinuesPastFailures(t *testing.T) {
+	names := []string{
+		"fixtures/hirama/2014.csv",
+		"fixtures/nothing.json",
+		"fixtures/hirama/nothing.json",
+	}
+	im := &Importer{}
+	results := im.ImportAll(names, 2)
+	if len(results) != len(names) {
+		t.Fatalf("It should return %d results. But got %d", len(names),
+			len(results))
+	}
+	for i, r := range results {
+		if r.Name != names[i] || r.Err == nil {
+			t.Fatalf("%s should fail in order: %v", names[i], r)
+		}
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	results := []*ImportResult{
+		{Name: "a.json", Diff: &GalleryDiff{GalleryId: "a",
+			Created: []Exhibition{{Id: "1"}}, Unchanged: 2}},
+		{Name: "b.json", Diff: &GalleryDiff{GalleryId: "b", Skipped: true,
+			Warnings: []string{`Unknown attribute "adress"`}}},
+		{Name: "c.json", Err: errors.New("Invalid Id")},
+	}
+	var buf bytes.Buffer
+	if failed := WriteSummary(&buf, results); failed != 1 {
+		t.Fatalf("It should return 1 failure. But got %d", failed)
+	}
+	contains := []string{
+		"OK   a.json a: 1 created, 0 changed, 0 removed, 2 unchanged",
+		"SKIP b.json b: unchanged",
+		`WARN b.json: Unknown attribute "adress"`,
+		"FAIL c.json: Invalid Id",
+		"3 galleries: 1 imported, 1 skipped, 1 failed",
+	}
+	for _, s := range contains {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("%s should contains \"%s\"", buf.String(), s)
+		}
+	}
+}
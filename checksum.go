@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// galleryChecksumName is the name of the checksum of a gallery JSON. Other
+// checksums are named after exhibition files listed in the gallery JSON.
+const galleryChecksumName = ""
+
+// importerChecksumName is the name of the checksum of importer options and
+// geocoder data, that change imported data as well as files.
+const importerChecksumName = "#importer"
+
+// Checksum is a checksum of an imported gallery JSON or exhibition file.
+type Checksum struct {
+	Name     string    `json:"name"`
+	Checksum string    `json:"checksum"`
+	Imported time.Time `json:"imported"`
+	Changed  time.Time `json:"changed"`
+}
+
+// checksum returns a hex encoded SHA-256 checksum of the trimmed data.
+func checksum(b []byte) string {
+	sum := sha256.Sum256(bytes.TrimSpace(b))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListChecksums returns checksums of a gallery.
+func ListChecksums(galleryId string) ([]*Checksum, error) {
+	return ListChecksumsWith(db, galleryId)
+}
+
+// ListChecksumsWith returns checksums of a gallery with q.
+func ListChecksumsWith(q Querier, galleryId string) ([]*Checksum, error) {
+	rows, err := q.Query(`
+		SELECT
+			name, checksum, imported, changed
+		FROM
+			import_checksum
+		WHERE
+			gallery_id = $1
+		ORDER BY
+			name
+	`, galleryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []*Checksum{}
+	for rows.Next() {
+		c := &Checksum{}
+		if err := rows.Scan(&c.Name, &c.Checksum, &c.Imported, &c.Changed); err != nil {
+			return nil, err
+		}
+		results = append(results, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SaveChecksumsWith stores checksums of a gallery, which maps names to
+// checksums, with q. Imported time of every checksum is updated and Changed
+// time is updated only if the checksum differs. Checksums of files that are
+// no longer listed are deleted.
+func SaveChecksumsWith(q Querier, galleryId string, checksums map[string]string) error {
+	stored, err := ListChecksumsWith(q, galleryId)
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool)
+	for _, c := range stored {
+		exists[c.Name] = true
+		if _, ok := checksums[c.Name]; ok {
+			continue
+		}
+		_, err = q.Exec(`
+			DELETE FROM
+				import_checksum
+			WHERE
+				gallery_id = $1 AND name = $2
+		`, galleryId, c.Name)
+		if err != nil {
+			return err
+		}
+	}
+	for name, sum := range checksums {
+		if exists[name] {
+			_, err = q.Exec(`
+				UPDATE
+					import_checksum
+				SET
+					(checksum, imported, changed) = ($3, now(),
+						CASE WHEN checksum = $3 THEN changed ELSE now() END)
+				WHERE
+					gallery_id = $1 AND name = $2
+			`, galleryId, name, sum)
+		} else {
+			_, err = q.Exec(`
+				INSERT INTO
+					import_checksum (gallery_id, name, checksum)
+				VALUES
+					($1, $2, $3)
+			`, galleryId, name, sum)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChecksum(t *testing.T) {
+	a := checksum([]byte("id,title\n2014-1,新春彫刻展\n"))
+	b := checksum([]byte("\n id,title\n2014-1,新春彫刻展"))
+	if a != b {
+		t.Fatal("Checksum should ignore leading and trailing spaces")
+	}
+	if len(a) != 64 {
+		t.Fatalf("Checksum should be a hex encoded SHA-256: %s", a)
+	}
+	if a == checksum([]byte("id,title\n2014-1,新春彫刻展【後期】")) {
+		t.Fatal("Checksum should differ")
+	}
+}
+
+func TestReadGallery(t *testing.T) {
+	gallery := []byte(`{
+		"id": "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		"name": "ヒラマ画廊",
+		"exhibitions": ["2014.csv"]
+	}`)
+	l := mapLoader{
+		"hirama.json": gallery,
+		"2014.csv":    []byte(hiramaCSV),
+	}
+	data, err := readGallery(l, "hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		galleryChecksumName: checksum(gallery),
+		"2014.csv":          checksum([]byte(hiramaCSV)),
+	}
+	if !sameChecksums([]*Checksum{
+		{Name: galleryChecksumName, Checksum: expected[galleryChecksumName]},
+		{Name: "2014.csv", Checksum: expected["2014.csv"]},
+	}, data.Checksums) {
+		t.Fatalf("Expected %v. But got %v instead", expected, data.Checksums)
+	}
+	if sameChecksums([]*Checksum{
+		{Name: galleryChecksumName, Checksum: expected[galleryChecksumName]},
+	}, data.Checksums) {
+		t.Fatal("Checksums should differ without 2014.csv")
+	}
+
+	exhibitions, err := data.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 2 {
+		t.Fatalf("It should parse 2 exhibitions. But got %v", exhibitions)
+	}
+}
+
+func TestSaveChecksums(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	g := MustHaveGallery()
+
+	checksums := map[string]string{
+		galleryChecksumName: checksum([]byte("gallery")),
+		"2013.csv":          checksum([]byte("2013")),
+	}
+	if err := SaveChecksumsWith(db, g.Id, checksums); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ListChecksums(g.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameChecksums(stored, checksums) {
+		t.Fatalf("Expected %v. But got %v instead", checksums, stored)
+	}
+	changed := stored[0].Changed
+
+	time.Sleep(10 * time.Millisecond)
+	checksums = map[string]string{
+		galleryChecksumName: checksum([]byte("gallery")),
+		"2014.csv":          checksum([]byte("2014")),
+	}
+	if err = SaveChecksumsWith(db, g.Id, checksums); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err = ListChecksums(g.Id); err != nil {
+		t.Fatal(err)
+	}
+	if !sameChecksums(stored, checksums) {
+		t.Fatalf("Expected %v. But got %v instead", checksums, stored)
+	}
+	if stored[0].Name != galleryChecksumName || !stored[0].Changed.Equal(changed) {
+		t.Fatalf("Changed time of an unchanged checksum should be kept: %v",
+			stored[0])
+	}
+	if !stored[0].Imported.After(changed) {
+		t.Fatalf("Imported time should be updated: %v", stored[0])
+	}
+}
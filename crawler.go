@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// crawlTick is the interval of checking due sources.
+const crawlTick = time.Minute
+
+// crawlLoader is an httpLoader that records validators and the status code of
+// responses.
+type crawlLoader struct {
+	httpLoader
+	validators map[string]*validator
+	code       int
+}
+
+func (l *crawlLoader) Open(name string) (io.ReadCloser, error) {
+	res, err := l.client().Get(name)
+	if err != nil {
+		return nil, err
+	}
+	l.code = res.StatusCode
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", name, res.Status)
+	}
+	l.validators[name] = &validator{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	return limitBody(name, res.Body), nil
+}
+
+func (l *crawlLoader) Exists(name string) (bool, error) {
+	res, err := l.client().Head(name)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	l.code = res.StatusCode
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusGone:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD %s: %s", name, res.Status)
+}
+
+// Crawler imports registered gallery sources periodically.
+type Crawler struct {
+	Importer *Importer
+	Client   *http.Client
+	// Interval is the default interval of crawling a source.
+	Interval time.Duration
+	// Out is where results are written.
+	Out io.Writer
+
+	mu sync.Mutex
+	// locks are locks of galleries being crawled.
+	locks map[string]*sync.Mutex
+}
+
+func (c *Crawler) client() *http.Client {
+	if c.Client == nil {
+		return httpClient
+	}
+	return c.Client
+}
+
+// lock locks a gallery, and returns the function to unlock it. The periodic
+// crawl and webhook jobs don't import the same source at the same time.
+func (c *Crawler) lock(galleryId string) func() {
+	c.mu.Lock()
+	if c.locks == nil {
+		c.locks = make(map[string]*sync.Mutex)
+	}
+	l, ok := c.locks[galleryId]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[galleryId] = l
+	}
+	c.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// modified makes conditional GET requests for the gallery JSON and exhibition
+// files of the last fetch. It reports whether any of them is modified, and
+// returns the last status code. A source that has never been fetched is
+// modified.
+func (c *Crawler) modified(s *Source) (modified bool, code int, err error) {
+	if len(s.Validators) == 0 {
+		return true, 0, nil
+	}
+	urls := []string{}
+	for url := range s.Validators {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return false, 0, err
+		}
+		v := s.Validators[url]
+		if v.ETag != "" {
+			req.Header.Set("If-None-Match", v.ETag)
+		}
+		if v.LastModified != "" {
+			req.Header.Set("If-Modified-Since", v.LastModified)
+		}
+		res, err := c.client().Do(req)
+		if err != nil {
+			return false, 0, err
+		}
+		res.Body.Close()
+		code = res.StatusCode
+		if res.StatusCode != http.StatusNotModified {
+			return true, code, nil
+		}
+	}
+	return false, code, nil
+}
+
+// Crawl imports a source if it is modified, and stores the status. The
+// result is written to Out. It waits for another crawl of the same gallery.
+func (c *Crawler) Crawl(s *Source) *ImportResult {
+	defer c.lock(s.GalleryId)()
+	start := time.Now()
+	r := &ImportResult{Name: s.URL}
+	modified, code, err := c.modified(s)
+	s.HTTPCode = code
+	switch {
+	case err != nil:
+		r.Err = err
+	case !modified:
+		r.Diff = &GalleryDiff{GalleryId: s.GalleryId, Skipped: true}
+	default:
+		l := &crawlLoader{
+			httpLoader: httpLoader{Client: c.Client},
+			validators: make(map[string]*validator),
+		}
+		r.Diff, r.Err = c.Importer.ImportFor(l, s.URL, s.GalleryId)
+		s.HTTPCode = l.code
+		if r.Err == nil {
+			s.Validators = l.validators
+		}
+	}
+	r.Duration = time.Since(start)
+
+	s.Checked = start
+	s.LastError = ""
+	switch {
+	case r.Err != nil:
+		s.Status = SOURCE_FAILED
+		s.LastError = r.Err.Error()
+	case r.Diff.Skipped:
+		s.Status = SOURCE_UNCHANGED
+	default:
+		s.Status = SOURCE_IMPORTED
+	}
+	if err := s.SaveStatus(); err != nil && r.Err == nil {
+		r.Err = err
+	}
+	if c.Out != nil {
+		writeResult(c.Out, r)
+	}
+	return r
+}
+
+// CrawlGallery crawls the source of a gallery now. It returns the status of
+// the source.
+func (c *Crawler) CrawlGallery(galleryId string) (string, error) {
+	s, err := GetSource(galleryId)
+	if err != nil {
+		return "", err
+	} else if s == nil {
+		return "", fmt.Errorf("No source is registered for gallery %s",
+			galleryId)
+	}
+	r := c.Crawl(s)
+	return s.Status, r.Err
+}
+
+// CrawlDue crawls sources that are due at now.
+func (c *Crawler) CrawlDue(now time.Time) ([]*ImportResult, error) {
+	sources, err := ListDueSources(now, c.Interval)
+	if err != nil {
+		return nil, err
+	}
+	results := []*ImportResult{}
+	for _, s := range sources {
+		results = append(results, c.Crawl(s))
+	}
+	return results, nil
+}
+
+// Run crawls due sources periodically until stop is closed. Failures are
+// recorded in sources and don't stop crawling.
+func (c *Crawler) Run(stop <-chan struct{}) {
+	tick := crawlTick
+	if c.Interval < tick {
+		tick = c.Interval
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		if _, err := c.CrawlDue(time.Now()); err != nil && c.Out != nil {
+			fmt.Fprintf(c.Out, "FAIL crawl: %s\n", err.Error())
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterSources registers URLs of galleries that are imported successfully
+// to crawl.
+func RegisterSources(results []*ImportResult) error {
+	for _, r := range results {
+		if r.Err != nil || !isURL(r.Name) {
+			continue
+		}
+		if err := RegisterSource(r.Diff.GalleryId, r.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// mustCopyHirama copies the hirama fixture into a temporary directory.
+func mustCopyHirama() string {
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"hirama.json", "2014.csv"} {
+		b, err := ioutil.ReadFile(path.Join("fixtures/hirama", name))
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name), b, 0644); err != nil {
+			panic(err)
+		}
+	}
+	return dir
+}
+
+func TestCrawlerModified(t *testing.T) {
+	dir := mustCopyHirama()
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	c := &Crawler{}
+	s := &Source{URL: ts.URL + "/hirama.json"}
+	if modified, _, err := c.modified(s); err != nil || !modified {
+		t.Fatalf("A source without validators should be modified. %v", err)
+	}
+
+	l := &crawlLoader{validators: make(map[string]*validator)}
+	for _, name := range []string{"/hirama.json", "/2014.csv"} {
+		rc, err := l.Open(ts.URL + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+	}
+	s.Validators = l.validators
+	modified, code, err := c.modified(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified || code != http.StatusNotModified {
+		t.Fatalf("It should not be modified. But got %v, %d", modified, code)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path.Join(dir, "2014.csv"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	modified, code, err = c.modified(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !modified || code != http.StatusOK {
+		t.Fatalf("It should be modified. But got %v, %d", modified, code)
+	}
+}
+
+func TestCrawlerLock(t *testing.T) {
+	c := &Crawler{}
+	unlock := c.lock("a")
+	c.lock("b")()
+	locked := make(chan bool)
+	go func() {
+		c.lock("a")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("A locked gallery should not be locked again")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+}
+
+func TestCrawl(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	dir := mustCopyHirama()
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	im := &Importer{Prune: true}
+	results := im.ImportAll([]string{ts.URL + "/hirama.json"}, 1)
+	if err := RegisterSources(results); err != nil {
+		t.Fatal(err)
+	}
+	galleryId := "b9fe1506-30c4-4cff-b73e-99d859199a6d"
+	c := &Crawler{Importer: im, Interval: time.Hour}
+	now := time.Now()
+	crawl := func(expected string, code int) *Source {
+		now = now.Add(2 * time.Hour)
+		results, err := c.CrawlDue(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("It should crawl a source. But got %d", len(results))
+		}
+		s, err := GetSource(galleryId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Status != expected || s.HTTPCode != code {
+			t.Fatalf("Expected %s %d. But got %s %d instead. %s", expected,
+				code, s.Status, s.HTTPCode, s.LastError)
+		}
+		return s
+	}
+
+	// never fetched by the crawler
+	crawl(SOURCE_UNCHANGED, http.StatusOK)
+	crawl(SOURCE_UNCHANGED, http.StatusNotModified)
+	if results, err := c.CrawlDue(now); err != nil || len(results) != 0 {
+		t.Fatalf("It should not crawl before the interval. %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path.Join(dir, "2014.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, "\n2014-99,光彩画廊コレクション展,,2014/12/01,2014/12/24\n"...)
+	later := time.Now().Add(time.Hour)
+	if err := ioutil.WriteFile(path.Join(dir, "2014.csv"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path.Join(dir, "2014.csv"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	crawl(SOURCE_IMPORTED, http.StatusOK)
+	e, err := GetExhibition(galleryId, "2014-99")
+	if err != nil || e == nil {
+		t.Fatalf("It should import a new exhibition. %v", err)
+	}
+
+	if err := os.Remove(path.Join(dir, "2014.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if s := crawl(SOURCE_FAILED, http.StatusNotFound); s.LastError == "" {
+		t.Fatal("It should record the last error")
+	}
+
+	// a source of another gallery that has the id of hirama
+	stored, err := ListExhibitionsWith(db, galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"other.json": `{"id": "` + galleryId + `", "name": "Other",
+			"exhibitions": ["other.csv"]}`,
+		"other.csv": "id,title,start\n2014-1,Other,2014/01/05\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content),
+			0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := MustHaveGallery()
+	if err := RegisterSource(other.Id, ts.URL+"/other.json"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := GetSource(other.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := c.Crawl(s); r.Err == nil || s.Status != SOURCE_FAILED {
+		t.Fatalf("A source of another gallery should fail: %v", r.Err)
+	}
+	if g, err := GetGallery(galleryId); err != nil || g.Name != "ヒラマ画廊" {
+		t.Fatalf("Another gallery should not be overwritten: %v %v", g, err)
+	}
+	if exhibitions, err := ListExhibitionsWith(db, galleryId); err != nil ||
+		len(exhibitions) != len(stored) {
+		t.Fatalf("Exhibitions of another gallery should not be pruned: %v",
+			err)
+	}
+}
@@ -11,12 +11,23 @@ SET client_min_messages = warning;
 
 SET search_path = public, pg_catalog;
 
+ALTER TABLE ONLY public.import_checksum DROP CONSTRAINT import_checksum_gallery_id_fkey;
+ALTER TABLE ONLY public.gallery_source DROP CONSTRAINT gallery_source_gallery_id_fkey;
+ALTER TABLE ONLY public.gallery_closure DROP CONSTRAINT gallery_closure_gallery_id_fkey;
 ALTER TABLE ONLY public.exhibition DROP CONSTRAINT exhibition_gallery_id_fkey;
+DROP INDEX public.gallery_closure_gallery;
 DROP INDEX public.exhibition_substring_idx;
 DROP INDEX public.exhibition_gallery;
 DROP INDEX public.date_range;
+ALTER TABLE ONLY public.import_checksum DROP CONSTRAINT import_checksum_pkey;
+ALTER TABLE ONLY public.gallery_token DROP CONSTRAINT gallery_token_pkey;
+ALTER TABLE ONLY public.gallery_source DROP CONSTRAINT gallery_source_pkey;
 ALTER TABLE ONLY public.gallery DROP CONSTRAINT gallery_pkey;
 ALTER TABLE ONLY public.exhibition DROP CONSTRAINT exhibition_pkey;
+DROP TABLE public.import_checksum;
+DROP TABLE public.gallery_token;
+DROP TABLE public.gallery_source;
+DROP TABLE public.gallery_closure;
 DROP TABLE public.gallery;
 DROP TABLE public.exhibition;
 DROP EXTENSION plpgsql;
@@ -64,6 +75,8 @@ CREATE TABLE exhibition (
     title character varying(500) NOT NULL,
     description character varying(5000) NOT NULL,
     date_range daterange NOT NULL,
+    alerts json DEFAULT '[]'::json NOT NULL,
+    note character varying(5000) DEFAULT ''::character varying NOT NULL,
     created timestamp with time zone DEFAULT ('now'::text)::date,
     updated timestamp with time zone
 );
@@ -76,13 +89,129 @@ CREATE TABLE exhibition (
 CREATE TABLE gallery (
     id uuid NOT NULL,
     name character varying(100) NOT NULL,
-    meta json NOT NULL,
     about character varying(2000) NOT NULL,
+    postal_code character varying(8) DEFAULT ''::character varying NOT NULL,
+    prefecture character varying(10) DEFAULT ''::character varying NOT NULL,
+    city character varying(100) DEFAULT ''::character varying NOT NULL,
+    street character varying(200) DEFAULT ''::character varying NOT NULL,
+    open_at time without time zone,
+    close_at time without time zone,
+    closed_on smallint DEFAULT 0 NOT NULL,
+    latitude double precision,
+    longitude double precision,
     created timestamp with time zone DEFAULT ('now'::text)::date,
     updated timestamp with time zone
 );
 
 
+--
+-- Name: COLUMN gallery.closed_on; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery.closed_on IS 'weekly closing days, a bit for each day of the week from Sunday';
+
+
+--
+-- Name: COLUMN gallery.latitude; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery.latitude IS 'latitude in degrees, or NULL if the location is unknown';
+
+
+--
+-- Name: gallery_closure; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE gallery_closure (
+    gallery_id uuid NOT NULL,
+    date_range daterange NOT NULL,
+    note character varying(500) DEFAULT ''::character varying NOT NULL
+);
+
+
+--
+-- Name: COLUMN gallery_closure.date_range; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery_closure.date_range IS 'irregular closure of the gallery in addition to weekly closing days';
+
+
+--
+-- Name: gallery_source; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE gallery_source (
+    gallery_id uuid NOT NULL,
+    url character varying(2000) NOT NULL,
+    interval_seconds integer DEFAULT 0 NOT NULL,
+    validators json DEFAULT '{}'::json NOT NULL,
+    status character varying(20) DEFAULT 'pending'::character varying NOT NULL,
+    http_code integer DEFAULT 0 NOT NULL,
+    last_error text DEFAULT ''::text NOT NULL,
+    checked timestamp with time zone DEFAULT '1970-01-01 00:00:00+00'::timestamp with time zone NOT NULL,
+    webhook_secret character varying(64) DEFAULT ''::character varying NOT NULL
+);
+
+
+--
+-- Name: COLUMN gallery_source.interval_seconds; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery_source.interval_seconds IS 'seconds between crawls, or 0 for the default interval of the crawler';
+
+
+--
+-- Name: COLUMN gallery_source.validators; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery_source.validators IS 'ETag and Last-Modified of each fetched URL';
+
+
+--
+-- Name: COLUMN gallery_source.webhook_secret; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery_source.webhook_secret IS 'secret to sign webhook requests, or empty if the webhook is disabled';
+
+
+--
+-- Name: gallery_token; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE gallery_token (
+    gallery_id uuid NOT NULL,
+    token_hash character(64) NOT NULL,
+    created timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: COLUMN gallery_token.token_hash; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN gallery_token.token_hash IS 'SHA-256 of the token to upload gallery data';
+
+
+--
+-- Name: import_checksum; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE import_checksum (
+    gallery_id uuid NOT NULL,
+    name character varying(2000) NOT NULL,
+    checksum character(64) NOT NULL,
+    imported timestamp with time zone DEFAULT now() NOT NULL,
+    changed timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: COLUMN import_checksum.name; Type: COMMENT; Schema: public; Owner: -
+--
+
+COMMENT ON COLUMN import_checksum.name IS 'exhibition file name listed in gallery JSON, or empty for gallery JSON';
+
+
 --
 -- Name: exhibition_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -99,6 +228,30 @@ ALTER TABLE ONLY gallery
     ADD CONSTRAINT gallery_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: gallery_source_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY gallery_source
+    ADD CONSTRAINT gallery_source_pkey PRIMARY KEY (gallery_id);
+
+
+--
+-- Name: gallery_token_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY gallery_token
+    ADD CONSTRAINT gallery_token_pkey PRIMARY KEY (gallery_id);
+
+
+--
+-- Name: import_checksum_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY import_checksum
+    ADD CONSTRAINT import_checksum_pkey PRIMARY KEY (gallery_id, name);
+
+
 --
 -- Name: date_range; Type: INDEX; Schema: public; Owner: -
 --
@@ -113,6 +266,13 @@ CREATE INDEX date_range ON exhibition USING gist (date_range);
 CREATE UNIQUE INDEX exhibition_gallery ON exhibition USING btree (gallery_id, lower(date_range));
 
 
+--
+-- Name: gallery_closure_gallery; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX gallery_closure_gallery ON gallery_closure USING btree (gallery_id);
+
+
 --
 -- Name: exhibition_substring_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -128,6 +288,30 @@ ALTER TABLE ONLY exhibition
     ADD CONSTRAINT exhibition_gallery_id_fkey FOREIGN KEY (gallery_id) REFERENCES gallery(id);
 
 
+--
+-- Name: gallery_closure_gallery_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY gallery_closure
+    ADD CONSTRAINT gallery_closure_gallery_id_fkey FOREIGN KEY (gallery_id) REFERENCES gallery(id);
+
+
+--
+-- Name: gallery_source_gallery_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY gallery_source
+    ADD CONSTRAINT gallery_source_gallery_id_fkey FOREIGN KEY (gallery_id) REFERENCES gallery(id);
+
+
+--
+-- Name: import_checksum_gallery_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY import_checksum
+    ADD CONSTRAINT import_checksum_gallery_id_fkey FOREIGN KEY (gallery_id) REFERENCES gallery(id);
+
+
 --
 -- PostgreSQL database dump complete
 --
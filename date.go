@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are layouts of dates in exhibition files. Months and days can
+// be zero padded or not.
+var dateLayouts = []string{
+	"2006/1/2",
+	"2006-1-2",
+	"2006.1.2",
+	"2006年1月2日",
+}
+
+// japaneseEra is a Japanese era and the year it started.
+type japaneseEra struct {
+	Name   string
+	Letter string
+	Year   int
+}
+
+var japaneseEras = []japaneseEra{
+	{"明治", "M", 1868},
+	{"大正", "T", 1912},
+	{"昭和", "S", 1926},
+	{"平成", "H", 1989},
+	{"令和", "R", 2019},
+}
+
+var (
+	// e.g. 令和6年1月5日, 令和元年5月1日
+	eraDateRegexp = regexp.MustCompile(`^(明治|大正|昭和|平成|令和)(元|\d+)年(\d+)月(\d+)日$`)
+	// e.g. R6.1.5, H26/1/5
+	eraLetterDateRegexp = regexp.MustCompile(`^([MTSHR])(\d+)[./-](\d+)[./-](\d+)$`)
+)
+
+// openEndMarkers are end dates of permanent exhibitions.
+var openEndMarkers = []string{"permanent", "常設", "未定"}
+
+// normalizeDate converts full width digits and symbols into ASCII and removes
+// spaces.
+func normalizeDate(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return '0' + r - '０'
+		case r >= 'Ａ' && r <= 'Ｚ':
+			return 'A' + r - 'Ａ'
+		case r == '／':
+			return '/'
+		case r == '－':
+			return '-'
+		case r == '．':
+			return '.'
+		case r == ' ' || r == '\t' || r == '　':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// date returns the date if year, month and day are valid.
+func date(year, month, day int) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return t, t.Year() == year && int(t.Month()) == month && t.Day() == day
+}
+
+// parseEraDate parses a date of a Japanese era.
+func parseEraDate(s string) (time.Time, bool) {
+	m := eraDateRegexp.FindStringSubmatch(s)
+	if m == nil {
+		if m = eraLetterDateRegexp.FindStringSubmatch(s); m == nil {
+			return time.Time{}, false
+		}
+	}
+	var base int
+	for _, era := range japaneseEras {
+		if era.Name == m[1] || era.Letter == m[1] {
+			base = era.Year
+		}
+	}
+	year := 1
+	if m[2] != "元" {
+		year, _ = strconv.Atoi(m[2])
+	}
+	month, _ := strconv.Atoi(m[3])
+	day, _ := strconv.Atoi(m[4])
+	if year < 1 {
+		return time.Time{}, false
+	}
+	return date(base+year-1, month, day)
+}
+
+// parseDate parses a date of an exhibition file. e.g. "2014/01/05",
+// "2014-1-5", "2014年1月5日" and "令和6年1月5日".
+func parseDate(s string) (time.Time, error) {
+	n := normalizeDate(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, n); err == nil {
+			return t, nil
+		}
+	}
+	if t, ok := parseEraDate(n); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid date: %s", s)
+}
+
+// isOpenEnd reports whether s is an end date of a permanent exhibition.
+func isOpenEnd(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, marker := range openEndMarkers {
+		if s == marker {
+			return true
+		}
+	}
+	return false
+}
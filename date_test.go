@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	expected := time.Date(2014, 1, 5, 0, 0, 0, 0, time.UTC)
+	for _, s := range []string{
+		"2014/01/05",
+		"2014/1/5",
+		"2014-01-05",
+		"2014.1.5",
+		"２０１４／０１／０５",
+		"2014年1月5日",
+		"2014年 1月 5日",
+		"平成26年1月5日",
+		"H26.1.5",
+	} {
+		d, err := parseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Equal(expected) {
+			t.Fatalf("%s: Expected %v. But got %v instead", s, expected, d)
+		}
+	}
+
+	cases := map[string]time.Time{
+		"令和6年1月5日":  time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		"令和元年5月1日":  time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+		"昭和64年1月7日": time.Date(1989, 1, 7, 0, 0, 0, 0, time.UTC),
+		"R6/1/5":    time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+	}
+	for s, expected := range cases {
+		d, err := parseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Equal(expected) {
+			t.Fatalf("%s: Expected %v. But got %v instead", s, expected, d)
+		}
+	}
+
+	for _, s := range []string{"", "2014/13/05", "2014/02/30", "令和0年1月5日",
+		"平成26年2月30日", "2014年1月", "01/05/2014"} {
+		if _, err := parseDate(s); err == nil {
+			t.Fatalf("%s should be an invalid date", s)
+		}
+	}
+}
+
+func TestParseExhibitionsOpenEnd(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	csv := `id,title,start,end
+2014-1,新年おめでとう展【後期】,2014年1月5日,2014-01-13
+2014-2,オープニングパーティー,平成26年1月14日,
+2014-3,コレクション展,2014/01/15,常設
+`
+	exhibitions, err := ImportExhibition(galleryId, bytes.NewReader([]byte(csv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"[2014-01-05,2014-01-13]",
+		"[2014-01-14,2014-01-14]",
+		"[2014-01-15,)",
+	}
+	for i, e := range exhibitions {
+		if e.DateRange.Format() != expected[i] {
+			t.Fatalf("%s: Expected %s. But got %s instead", e.Id, expected[i],
+				e.DateRange.Format())
+		}
+	}
+	if !exhibitions[2].DateRange.IsOpen() {
+		t.Fatal("A permanent exhibition should have no end")
+	}
+}
+
+func TestDateRangeOpenMarshaling(t *testing.T) {
+	b := []byte(`["2014-01-15",null]`)
+	var dr dateRange
+	if err := json.Unmarshal(b, &dr); err != nil {
+		t.Fatal(err)
+	}
+	if !dr.IsOpen() {
+		t.Fatal("It should have no end")
+	}
+	b2, err := json.Marshal(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(b2) {
+		t.Fatalf("Expected %s. But got %s instead", b, b2)
+	}
+	for _, s := range []string{`[null,"2014-01-15"]`, `["2014-01-15"]`,
+		`"2014-01-15"`} {
+		if err := json.Unmarshal([]byte(s), &dr); err == nil {
+			t.Fatalf("%s should be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// FieldChange is a change of a field value.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+func (c *FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, formatValue(c.Old),
+		formatValue(c.New))
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case dateRange:
+		return v.Format()
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// ExhibitionChange is a list of changes of an exhibition.
+type ExhibitionChange struct {
+	Id      string         `json:"id"`
+	Title   string         `json:"title"`
+	Changes []*FieldChange `json:"changes"`
+}
+
+// GalleryDiff is the difference between the stored gallery and imported data.
+type GalleryDiff struct {
+	GalleryId  string              `json:"gallery_id"`
+	Name       string              `json:"name"`
+	NewGallery bool                `json:"new_gallery"`
+	Gallery    []*FieldChange      `json:"gallery"`
+	Created    []Exhibition        `json:"created"`
+	Changed    []*ExhibitionChange `json:"changed"`
+	Removed    []Exhibition        `json:"removed"`
+	Unchanged  int                 `json:"unchanged"`
+	// Kept is the number of stored exhibitions that are not in exhibition
+	// files but kept since they are not pruned.
+	Kept int `json:"kept"`
+	// Skipped is true if the gallery JSON and exhibition files are not
+	// changed since the last import.
+	Skipped bool `json:"skipped"`
+	// Warnings are problems of imported data that don't stop importing.
+	Warnings []string `json:"warnings,omitempty"`
+	// Checksums maps names of the imported files to their checksums.
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// IsEmpty reports whether nothing would be changed.
+func (d *GalleryDiff) IsEmpty() bool {
+	return !d.NewGallery && len(d.Gallery) == 0 && len(d.Created) == 0 &&
+		len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// DiffGallery compares the stored gallery and exhibitions with imported ones.
+// old is nil if the gallery is not stored yet. Exhibitions are matched by id.
+func DiffGallery(old, g *Gallery, oldExhibitions, exhibitions []Exhibition) *GalleryDiff {
+	d := &GalleryDiff{
+		GalleryId:  g.Id,
+		Name:       g.Name,
+		NewGallery: old == nil,
+		Gallery:    []*FieldChange{},
+		Created:    []Exhibition{},
+		Changed:    []*ExhibitionChange{},
+		Removed:    []Exhibition{},
+	}
+	if old != nil {
+		d.Gallery = diffGallery(old, g)
+	}
+
+	stored := make(map[string]*Exhibition)
+	for i := range oldExhibitions {
+		stored[oldExhibitions[i].Id] = &oldExhibitions[i]
+	}
+	imported := make(map[string]bool)
+	for _, e := range exhibitions {
+		imported[e.Id] = true
+		o, ok := stored[e.Id]
+		if !ok {
+			d.Created = append(d.Created, e)
+			continue
+		}
+		if changes := diffExhibition(o, &e); len(changes) != 0 {
+			d.Changed = append(d.Changed,
+				&ExhibitionChange{e.Id, e.Title, changes})
+		} else {
+			d.Unchanged += 1
+		}
+	}
+	for _, e := range oldExhibitions {
+		if !imported[e.Id] {
+			d.Removed = append(d.Removed, e)
+		}
+	}
+	return d
+}
+
+func diffGallery(old, g *Gallery) (changes []*FieldChange) {
+	changes = []*FieldChange{}
+	if old.Name != g.Name {
+		changes = append(changes, &FieldChange{"name", old.Name, g.Name})
+	}
+	if old.About != g.About {
+		changes = append(changes, &FieldChange{"about", old.About, g.About})
+	}
+	if old.Address != g.Address {
+		changes = append(changes,
+			&FieldChange{"address", old.Address, g.Address})
+	}
+	if old.Hours != g.Hours {
+		changes = append(changes,
+			&FieldChange{"opening_hours", old.Hours, g.Hours})
+	}
+	if !equalLocation(old.Location, g.Location) {
+		changes = append(changes,
+			&FieldChange{"location", old.Location, g.Location})
+	}
+	if !equalClosures(old.Closures, g.Closures) {
+		changes = append(changes,
+			&FieldChange{"closures", old.Closures, g.Closures})
+	}
+	return
+}
+
+// equalLocation reports whether locations are the same. nil is unknown.
+func equalLocation(a, b *Location) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func diffExhibition(old, e *Exhibition) (changes []*FieldChange) {
+	if old.Title != e.Title {
+		changes = append(changes, &FieldChange{"title", old.Title, e.Title})
+	}
+	if old.Description != e.Description {
+		changes = append(changes,
+			&FieldChange{"description", old.Description, e.Description})
+	}
+	if !old.DateRange.Equal(e.DateRange) {
+		changes = append(changes,
+			&FieldChange{"date_range", old.DateRange, e.DateRange})
+	}
+	if !reflect.DeepEqual(old.Alerts, e.Alerts) {
+		changes = append(changes, &FieldChange{"alerts", old.Alerts, e.Alerts})
+	}
+	if old.Note != e.Note {
+		changes = append(changes, &FieldChange{"note", old.Note, e.Note})
+	}
+	return
+}
+
+// WriteText writes a human readable diff. Lines of created, changed and
+// removed exhibitions start with "+", "~" and "-".
+func (d *GalleryDiff) WriteText(w io.Writer) {
+	status := "update"
+	if d.NewGallery {
+		status = "new"
+	} else if d.Skipped {
+		fmt.Fprintf(w, "Gallery %s %s (unchanged)\n", d.GalleryId, d.Name)
+		d.writeWarnings(w)
+		return
+	}
+	fmt.Fprintf(w, "Gallery %s %s (%s)\n", d.GalleryId, d.Name, status)
+	d.writeWarnings(w)
+	for _, c := range d.Gallery {
+		fmt.Fprintf(w, "  ~ %s\n", c)
+	}
+	for _, e := range d.Created {
+		fmt.Fprintf(w, "  + %s %s %s\n", e.Id, e.Title, e.DateRange.Format())
+	}
+	for _, e := range d.Changed {
+		fmt.Fprintf(w, "  ~ %s %s\n", e.Id, e.Title)
+		for _, c := range e.Changes {
+			fmt.Fprintf(w, "      %s\n", c)
+		}
+	}
+	for _, e := range d.Removed {
+		fmt.Fprintf(w, "  - %s %s %s\n", e.Id, e.Title, e.DateRange.Format())
+	}
+	fmt.Fprintf(w, "  %d created, %d changed, %d removed, %d unchanged, "+
+		"%d kept\n", len(d.Created), len(d.Changed), len(d.Removed),
+		d.Unchanged, d.Kept)
+}
+
+// keep moves removed exhibitions to kept ones.
+func (d *GalleryDiff) keep() {
+	d.Kept += len(d.Removed)
+	d.Removed = []Exhibition{}
+}
+
+func (d *GalleryDiff) writeWarnings(w io.Writer) {
+	for _, warning := range d.Warnings {
+		fmt.Fprintf(w, "  ! %s\n", warning)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffGallery(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	old := &Gallery{Id: galleryId, Name: "ヒラマ画廊",
+		Hours: OpeningHours{"10:00", "18:00", 0}}
+	g := &Gallery{Id: galleryId, Name: "ヒラマ画廊", About: "About",
+		Hours: OpeningHours{"10:00", "18:00", 0}}
+	oldExhibitions := []Exhibition{
+		{Id: "2014-1", Title: "新年おめでとう展【後期】",
+			DateRange: *MustParseDateRange("2014-01-05", "2014-01-13")},
+		{Id: "2014-2", Title: "新春彫刻展",
+			DateRange: *MustParseDateRange("2014-01-14", "2014-01-20")},
+		{Id: "2014-3", Title: "光彩画廊コレクション展",
+			DateRange: *MustParseDateRange("2014-01-21", "2014-01-27")},
+	}
+	exhibitions := []Exhibition{
+		{Id: "2014-1", Title: "新年おめでとう展【後期】",
+			DateRange: *MustParseDateRange("2014-01-05", "2014-01-13")},
+		{Id: "2014-2", Title: "新春彫刻展", Alerts: []string{"closed on 1/15"},
+			DateRange: *MustParseDateRange("2014-01-14", "2014-01-21")},
+		{Id: "2014-4", Title: "森清行・河原潤 二人展 二重星",
+			DateRange: *MustParseDateRange("2014-01-28", "2014-02-03")},
+	}
+
+	d := DiffGallery(old, g, oldExhibitions, exhibitions)
+	if d.NewGallery || len(d.Gallery) != 1 || d.Gallery[0].Field != "about" {
+		t.Fatalf("Only about should be changed: %v", d.Gallery)
+	}
+	if len(d.Created) != 1 || d.Created[0].Id != "2014-4" {
+		t.Fatalf("2014-4 should be created: %v", d.Created)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Id != "2014-2" ||
+		len(d.Changed[0].Changes) != 2 {
+		t.Fatalf("2014-2 should be changed: %v", d.Changed)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Id != "2014-3" {
+		t.Fatalf("2014-3 should be removed: %v", d.Removed)
+	}
+	if d.Unchanged != 1 {
+		t.Fatalf("1 exhibition should be unchanged: %d", d.Unchanged)
+	}
+
+	var buf bytes.Buffer
+	d.WriteText(&buf)
+	contains := []string{
+		`~ about: "" -> "About"`,
+		"+ 2014-4 森清行・河原潤 二人展 二重星 [2014-01-28,2014-02-03]",
+		"~ 2014-2 新春彫刻展",
+		"date_range: [2014-01-14,2014-01-20] -> [2014-01-14,2014-01-21]",
+		"alerts: [] -> [closed on 1/15]",
+		"- 2014-3 光彩画廊コレクション展 [2014-01-21,2014-01-27]",
+		"1 created, 1 changed, 1 removed, 1 unchanged",
+	}
+	for _, s := range contains {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("%s should contains \"%s\"", buf.String(), s)
+		}
+	}
+
+	// removed exhibitions are kept without pruning
+	d.keep()
+	buf.Reset()
+	d.WriteText(&buf)
+	if strings.Contains(buf.String(), "- 2014-3") ||
+		!strings.Contains(buf.String(), "0 removed, 1 unchanged, 1 kept") {
+		t.Fatalf("2014-3 should be kept: %s", buf.String())
+	}
+
+	d = DiffGallery(nil, g, nil, exhibitions)
+	if !d.NewGallery || len(d.Created) != 3 || d.IsEmpty() {
+		t.Fatalf("Everything should be created: %v", d)
+	}
+	d = DiffGallery(g, g, exhibitions, exhibitions)
+	if !d.IsEmpty() || d.Unchanged != 3 {
+		t.Fatalf("Nothing should be changed: %v", d)
+	}
+}
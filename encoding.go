@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// lookupEncoding returns the encoding of the given name. Names are WHATWG
+// encoding labels such as "utf-8", "shift_jis", "sjis" or "euc-jp". It returns
+// nil for an empty name, which means the encoding should be detected.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unsupported encoding %s", name)
+	}
+	return enc, nil
+}
+
+// detectEncoding guesses the encoding of b. A byte order mark is respected.
+// Valid UTF-8 is treated as UTF-8. Otherwise it tries Shift_JIS and EUC-JP,
+// which are common in files exported by Excel on Japanese Windows, and
+// returns the one that decodes with fewer invalid characters. Shift_JIS wins
+// a tie.
+func detectEncoding(b []byte) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return unicode.UTF8BOM
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case utf8.Valid(b):
+		return unicode.UTF8
+	}
+	best, bestCount := encoding.Encoding(japanese.ShiftJIS), -1
+	for _, enc := range []encoding.Encoding{japanese.ShiftJIS, japanese.EUCJP} {
+		decoded, err := enc.NewDecoder().Bytes(b)
+		if err != nil {
+			continue
+		}
+		count := bytes.Count(decoded, []byte(string(utf8.RuneError)))
+		if bestCount == -1 || count < bestCount {
+			best, bestCount = enc, count
+		}
+	}
+	return best
+}
+
+// decodeText transcodes b into UTF-8 and strips a byte order mark. The
+// encoding is detected if enc is nil.
+func decodeText(b []byte, enc encoding.Encoding) ([]byte, error) {
+	if enc == nil {
+		enc = detectEncoding(b)
+	}
+	if enc == unicode.UTF8 {
+		enc = unicode.UTF8BOM
+	}
+	return enc.NewDecoder().Bytes(b)
+}
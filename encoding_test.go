@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"reflect"
+	"testing"
+)
+
+const hiramaCSV = `id,タイトル:title,説明:description,開始日:start,最終日:end
+2014-1,新年おめでとう展【後期】,,2014/01/05,2014/01/13
+2014-2,新春彫刻展,,2014/01/14,2014/01/20
+`
+
+func mustEncode(enc encoding.Encoding, s string) []byte {
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		b        []byte
+		expected encoding.Encoding
+	}{
+		{[]byte(hiramaCSV), unicode.UTF8},
+		{append(bomUTF8, hiramaCSV...), unicode.UTF8BOM},
+		{mustEncode(japanese.ShiftJIS, hiramaCSV), japanese.ShiftJIS},
+		{mustEncode(japanese.EUCJP, hiramaCSV), japanese.EUCJP},
+	}
+	for i, c := range cases {
+		if enc := detectEncoding(c.b); enc != c.expected {
+			t.Fatalf("%d: Expected %v. But got %v instead", i, c.expected, enc)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	cases := [][]byte{
+		[]byte(hiramaCSV),
+		append(bomUTF8, hiramaCSV...),
+		mustEncode(japanese.ShiftJIS, hiramaCSV),
+		mustEncode(japanese.EUCJP, hiramaCSV),
+		mustEncode(utf16, hiramaCSV),
+	}
+	for i, b := range cases {
+		decoded, err := decodeText(b, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != hiramaCSV {
+			t.Fatalf("%d: Expected %q. But got %q instead", i, hiramaCSV, decoded)
+		}
+	}
+
+	// declared encoding
+	enc, err := lookupEncoding("sjis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeText(mustEncode(japanese.ShiftJIS, hiramaCSV), enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != hiramaCSV {
+		t.Fatalf("Expected %q. But got %q instead", hiramaCSV, decoded)
+	}
+	if _, err = lookupEncoding("klingon"); err == nil {
+		t.Fatal("It should return an error with unknown encoding")
+	}
+}
+
+func TestParseExhibitionFileEncoding(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	expected, err := ImportExhibition(galleryId,
+		bytes.NewReader([]byte(hiramaCSV)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"bom.csv":  append(bomUTF8, hiramaCSV...),
+		"sjis.csv": mustEncode(japanese.ShiftJIS, hiramaCSV),
+	}
+	for name, b := range files {
+		exhibitions, err := parseExhibitionFile(galleryId,
+			ExhibitionFile{Name: name}, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, exhibitions) {
+			t.Fatalf("%s: Expected %v. But got %v instead", name, expected,
+				exhibitions)
+		}
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"io"
 	"strings"
 	"time"
@@ -21,39 +22,137 @@ var (
 	db *sql.DB
 )
 
+// Querier is satisfied by both *sql.DB and *sql.Tx.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// withTransaction calls fn in a transaction. The transaction is rolled back if
+// fn returns an error, and committed otherwise.
+func withTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConflictError is an error of creating a row whose id already exists.
+type ConflictError struct {
+	Id string
+}
+
+func (err *ConflictError) Error() string {
+	return err.Id + " already exists"
+}
+
+// uniqueViolation reports whether err is a violation of the unique
+// constraint.
+func uniqueViolation(err error, constraint string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// conflictError returns a ConflictError of id if err is a violation of the
+// unique constraint, and err otherwise.
+func conflictError(err error, constraint, id string) error {
+	if uniqueViolation(err, constraint) {
+		return &ConflictError{id}
+	}
+	return err
+}
+
+// startError returns a ValidationError of the start if err is a violation of
+// the unique index of exhibitions of a gallery by start, and err otherwise.
+func (e *Exhibition) startError(err error) error {
+	if uniqueViolation(err, "exhibition_gallery") {
+		return ValidationError{fmt.Sprintf(
+			"Invalid start: another exhibition of the gallery starts on %s",
+			e.DateRange[0].Format(DATE_LAYOUT))}
+	}
+	return err
+}
+
+// dateRange is a range of dates. Both start and end are inclusive. A zero
+// end means the range has no end, like a permanent exhibition.
 type dateRange [2]time.Time
 
+// IsOpen reports whether the range has no end.
+func (dr dateRange) IsOpen() bool {
+	return dr[1].IsZero()
+}
+
+// MarshalJSON encodes the range as a pair of dates. The end is null if the
+// range has no end.
 func (dr dateRange) MarshalJSON() ([]byte, error) {
+	if dr.IsOpen() {
+		return []byte(fmt.Sprintf(`["%s",null]`, dr[0].Format(DATE_LAYOUT))), nil
+	}
 	return []byte(fmt.Sprintf(`["%s","%s"]`, dr[0].Format(DATE_LAYOUT),
 		dr[1].Format(DATE_LAYOUT))), nil
 }
 
-// len(`["2014-05-10","2014-05-20"]`) == 27
 func (dr *dateRange) UnmarshalJSON(data []byte) error {
-	l := len(data)
-	if l < 27 {
-		return errors.New("DateRange Parse Error: not enough length")
-	}
-	if data[0] != '[' || data[l-1] != ']' {
+	var d []*string
+	if err := json.Unmarshal(data, &d); err != nil {
 		return errors.New("DateRange Parse Error: daterange should be an array")
 	}
-	d := strings.Split(string(data[1:l-1]), ",")
 	if len(d) != 2 {
 		return errors.New("DateRange Parse Error: DataRange should have two item")
 	}
-	dr2, err := parseDateRange(strings.Trim(d[0], `" `), strings.Trim(d[1], `" `))
+	if d[0] == nil {
+		return errors.New("DateRange Parse Error: start should not be null")
+	}
+	start, err := time.Parse(DATE_LAYOUT, *d[0])
 	if err != nil {
-		return err
+		return errors.New("DateRange Parse Error: Invalid Date Start " + *d[0])
+	}
+	dr[0], dr[1] = start, time.Time{}
+	if d[1] == nil {
+		return nil
+	}
+	if dr[1], err = time.Parse(DATE_LAYOUT, *d[1]); err != nil {
+		return errors.New("DateRange Parse Error: Invalid Date End " + *d[1])
 	}
-	dr[0], dr[1] = dr2[0], dr2[1]
 	return nil
 }
 
+// Equal reports whether both ranges have the same dates regardless of time
+// zones.
+func (dr dateRange) Equal(other dateRange) bool {
+	for i := range dr {
+		if dr[i].Format(DATE_LAYOUT) != other[i].Format(DATE_LAYOUT) {
+			return false
+		}
+	}
+	return true
+}
+
+// Format returns the range in the format of PostgreSQL daterange. The upper
+// bound is omitted if the range has no end.
 func (dr *dateRange) Format() string {
+	if dr.IsOpen() {
+		return fmt.Sprintf("[%s,)", dr[0].Format(DATE_LAYOUT))
+	}
 	return fmt.Sprintf("[%s,%s]", dr[0].Format(DATE_LAYOUT),
 		dr[1].Format(DATE_LAYOUT))
 }
 
+// scanDateRange makes a range from lower and upper bounds of a daterange
+// column. upper is exclusive, and nil if the range has no end.
+func scanDateRange(lower time.Time, upper *time.Time) dateRange {
+	if upper == nil {
+		return dateRange{lower, time.Time{}}
+	}
+	return dateRange{lower, upper.AddDate(0, 0, -1)}
+}
+
 func parseDateRange(start, end string) (*dateRange, error) {
 	return parseDateRangeByLayout(start, end, DATE_LAYOUT)
 }
@@ -79,11 +178,37 @@ type Exhibition struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	DateRange   dateRange `json:"date_range"`
+	Alerts      []string  `json:"alerts,omitempty"`
+	Note        string    `json:"note,omitempty"`
 }
 
 type VExhibition struct {
 	Exhibition
 	Gallery Gallery `json:"gallery"`
+	// Distance is kilometers from the location of a search. nil unless the
+	// search is by location.
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+// alertsJSON returns alerts as a JSON array.
+func (e *Exhibition) alertsJSON() ([]byte, error) {
+	if e.Alerts == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e.Alerts)
+}
+
+// parseAlerts decodes a JSON array of alerts. It returns nil if there is no
+// alert.
+func parseAlerts(b []byte) ([]string, error) {
+	var alerts []string
+	if err := json.Unmarshal(b, &alerts); err != nil {
+		return nil, err
+	}
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+	return alerts, nil
 }
 
 func (e *Exhibition) GetByteId() []byte {
@@ -123,46 +248,73 @@ func (e *Exhibition) Validate() (err ValidationError) {
 
 // Create insert a row into exhibition table.
 func (e *Exhibition) Create() error {
+	return e.CreateWith(db)
+}
+
+// CreateWith insert a row into exhibition table with q.
+func (e *Exhibition) CreateWith(q Querier) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
+	alerts, err := e.alertsJSON()
+	if err != nil {
+		return err
+	}
 	b := e.GetByteId()
-	_, err := db.Exec(`
+	_, err = q.Exec(`
 		INSERT INTO
 			exhibition
-			(id, _byteid, gallery_id, title, description, date_range)
+			(id, _byteid, gallery_id, title, description, date_range, alerts,
+				note)
 		VALUES
-			($1, $2, $3, $4, $5, $6)
-	`, e.Id, b, e.GalleryId, e.Title, e.Description, e.DateRange.Format())
-	return err
+			($1, $2, $3, $4, $5, $6, $7, $8)
+	`, e.Id, b, e.GalleryId, e.Title, e.Description, e.DateRange.Format(),
+		alerts, e.Note)
+	return conflictError(e.startError(err), "exhibition_pkey", e.Id)
 }
 
 // Update update an exhibition row
 func (e *Exhibition) Update() error {
+	return e.UpdateWith(db)
+}
+
+// UpdateWith update an exhibition row with q.
+func (e *Exhibition) UpdateWith(q Querier) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
+	alerts, err := e.alertsJSON()
+	if err != nil {
+		return err
+	}
 	b := e.GetByteId()
 	hashId := e.GetHashId()
-	_, err := db.Exec(`
+	_, err = q.Exec(`
 		UPDATE
 			exhibition
 		SET
-			(_byteid, title, description, date_range) = ($2, $3, $4, $5)
+			(_byteid, title, description, date_range, alerts, note, updated) =
+				($2, $3, $4, $5, $6, $7, now())
 		WHERE
 			substring(_byteid, 5) = $1
-		`, hashId, b, e.Title, e.Description, e.DateRange.Format())
-	return err
+		`, hashId, b, e.Title, e.Description, e.DateRange.Format(), alerts,
+		e.Note)
+	return e.startError(err)
 }
 
 // Sync update if exists. If not create new model.
 func (e *Exhibition) Sync() error {
+	return e.SyncWith(db)
+}
+
+// SyncWith update if exists with q. If not create new model.
+func (e *Exhibition) SyncWith(q Querier) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 	var exists bool
 	hashId := e.GetHashId()
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 		SELECT EXISTS (
 			SELECT 1 FROM exhibition WHERE substring(_byteid, 5) = $1
 		)
@@ -172,16 +324,37 @@ func (e *Exhibition) Sync() error {
 		return err
 	}
 	if exists {
-		err = e.Update()
+		err = e.UpdateWith(q)
 	} else {
-		err = e.Create()
+		err = e.CreateWith(q)
+	}
+	return err
+}
+
+// Delete delete an exhibition row.
+func (e *Exhibition) Delete() error {
+	return e.DeleteWith(db)
+}
+
+// DeleteWith delete an exhibition row with q.
+func (e *Exhibition) DeleteWith(q Querier) error {
+	if err := e.Validate(); err != nil {
+		return err
 	}
+	_, err := q.Exec(`
+		DELETE FROM
+			exhibition
+		WHERE
+			substring(_byteid, 5) = $1
+	`, e.GetHashId())
 	return err
 }
 
 // GetExhibition fetch an exhibition model.
 func GetExhibition(galleryId, id string) (*Exhibition, error) {
-	var dateStart, dateEnd time.Time
+	var dateStart time.Time
+	var dateEnd *time.Time
+	var alerts []byte
 	e := &Exhibition{
 		GalleryId: galleryId,
 		Id:        id,
@@ -195,20 +368,84 @@ func GetExhibition(galleryId, id string) (*Exhibition, error) {
 	b := e.GetHashId()
 	err := db.QueryRow(`
 		SELECT
-			title, description, lower(date_range), upper(date_range)
+			title, description, lower(date_range), upper(date_range), alerts,
+			note
 		FROM
 			exhibition
 		WHERE
 			substring(_byteid, 5) = $1
-		`, b).Scan(&e.Title, &e.Description, &dateStart, &dateEnd)
+		`, b).Scan(&e.Title, &e.Description, &dateStart, &dateEnd, &alerts,
+		&e.Note)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
-	dateEnd = dateEnd.AddDate(0, 0, -1)
-	e.DateRange = dateRange{dateStart, dateEnd}
+	if e.Alerts, err = parseAlerts(alerts); err != nil {
+		return nil, err
+	}
+	e.DateRange = scanDateRange(dateStart, dateEnd)
+	return e, nil
+}
+
+// ListExhibitionsWith returns every exhibition of a gallery with q.
+func ListExhibitionsWith(q Querier, galleryId string) ([]Exhibition, error) {
+	rows, err := q.Query(`
+		SELECT
+			id, title, description, lower(date_range), upper(date_range),
+			alerts, note
+		FROM
+			exhibition
+		WHERE
+			gallery_id = $1
+		ORDER BY
+			lower(date_range)
+	`, galleryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []Exhibition{}
+	for rows.Next() {
+		var start time.Time
+		var end *time.Time
+		var alerts []byte
+		e := Exhibition{GalleryId: galleryId}
+		if err := rows.Scan(&e.Id, &e.Title, &e.Description, &start, &end,
+			&alerts, &e.Note); err != nil {
+			return nil, err
+		}
+		if e.Alerts, err = parseAlerts(alerts); err != nil {
+			return nil, err
+		}
+		e.DateRange = scanDateRange(start, end)
+		results = append(results, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// scanVExhibition scans an exhibition and its gallery followed by extra
+// columns.
+func scanVExhibition(rows *sql.Rows, extra ...interface{}) (*VExhibition, error) {
+	var start time.Time
+	var end *time.Time
+	var alerts []byte
+	e := &VExhibition{Gallery: Gallery{}}
+	dest := []interface{}{&e.Id, &e.Title, &start, &end, &alerts, &e.Note,
+		&e.Gallery.Id, &e.Gallery.Name}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	var err error
+	if e.Alerts, err = parseAlerts(alerts); err != nil {
+		return nil, err
+	}
+	e.DateRange = scanDateRange(start, end)
 	return e, nil
 }
 
@@ -216,13 +453,10 @@ func handleRows(rows *sql.Rows) ([]*VExhibition, error) {
 	defer rows.Close()
 	results := []*VExhibition{}
 	for rows.Next() {
-		var start, end time.Time
-		e := &VExhibition{Gallery: Gallery{}}
-		if err := rows.Scan(&e.Id, &e.Title, &start, &end, &e.Gallery.Id, &e.Gallery.Name); err != nil {
+		e, err := scanVExhibition(rows)
+		if err != nil {
 			return nil, err
 		}
-		end = end.AddDate(0, 0, -1)
-		e.DateRange = dateRange{start, end}
 		results = append(results, e)
 	}
 	if err := rows.Err(); err != nil {
@@ -234,7 +468,8 @@ func handleRows(rows *sql.Rows) ([]*VExhibition, error) {
 func ListExhibitionByGallery(galleryId string) ([]*VExhibition, error) {
 	rows, err := db.Query(`
 		SELECT
-			e.id, e.title, lower(e.date_range), upper(e.date_range), g.id, g.name
+			e.id, e.title, lower(e.date_range), upper(e.date_range), e.alerts,
+			e.note, g.id, g.name
 		FROM
 			exhibition AS e
 		JOIN
@@ -255,10 +490,14 @@ func ListExhibitionByGallery(galleryId string) ([]*VExhibition, error) {
 	return handleRows(rows)
 }
 
-func SearchExhibitions(dr *dateRange) ([]*VExhibition, error) {
+// SearchExhibitions returns exhibitions in the range. If openOn is not zero,
+// exhibitions are limited to those held on openOn at galleries open on the
+// date.
+func SearchExhibitions(dr *dateRange, openOn time.Time) ([]*VExhibition, error) {
 	rows, err := db.Query(`
 		SELECT
-			e.id, e.title, lower(e.date_range), upper(e.date_range), g.id, g.name
+			e.id, e.title, lower(e.date_range), upper(e.date_range), e.alerts,
+			e.note, g.id, g.name
 		FROM
 			exhibition AS e
 		JOIN
@@ -266,11 +505,11 @@ func SearchExhibitions(dr *dateRange) ([]*VExhibition, error) {
 		ON
 			e.gallery_id = g.id
 		WHERE
-			date_range && $1
+			date_range && $1 AND `+openOnFilterSQL("$2")+`
 		ORDER BY
 			upper(date_range)
 		LIMIT 100
-	`, dr.Format())
+	`, dr.Format(), openOnParam(openOn))
 
 	if err != nil {
 		return nil, err
@@ -278,3 +517,51 @@ func SearchExhibitions(dr *dateRange) ([]*VExhibition, error) {
 
 	return handleRows(rows)
 }
+
+// SearchExhibitionsNear returns exhibitions in the range at galleries within
+// radius kilometers of l, ordered by distance. openOn filters exhibitions the
+// same as SearchExhibitions.
+func SearchExhibitionsNear(dr *dateRange, l *Location, radius float64, openOn time.Time) ([]*VExhibition, error) {
+	rows, err := db.Query(`
+		SELECT
+			*
+		FROM (
+			SELECT
+				e.id, e.title, lower(e.date_range), upper(e.date_range),
+				e.alerts, e.note, g.id AS gallery_id, g.name,
+				`+distanceSQL("$2", "$3")+` AS distance
+			FROM
+				exhibition AS e
+			JOIN
+				gallery AS g
+			ON
+				e.gallery_id = g.id
+			WHERE
+				date_range && $1 AND g.latitude IS NOT NULL AND
+				g.longitude IS NOT NULL AND `+openOnFilterSQL("$5")+`
+		) AS near
+		WHERE
+			distance <= $4
+		ORDER BY
+			distance, upper
+		LIMIT 100
+	`, dr.Format(), l.Latitude, l.Longitude, radius, openOnParam(openOn))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []*VExhibition{}
+	for rows.Next() {
+		var distance float64
+		e, err := scanVExhibition(rows, &distance)
+		if err != nil {
+			return nil, err
+		}
+		e.Distance = &distance
+		results = append(results, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"github.com/smagch/patree"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -27,6 +29,8 @@ func (h *ExhibitionHandler) Get(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// FindByDate send exhibitions held on the date. With near=lat,lng they are
+// limited to galleries within radius kilometers, ordered by distance.
 func (h *ExhibitionHandler) FindByDate(w http.ResponseWriter, r *http.Request) error {
 	date := patree.Param(r, h.DateName)
 	d, err := time.Parse(DATE_LAYOUT, date)
@@ -34,8 +38,30 @@ func (h *ExhibitionHandler) FindByDate(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 	dr := &dateRange{d, d}
+	var openOn time.Time
+	if s := r.URL.Query().Get("open_on"); s != "" {
+		if openOn, err = time.Parse(DATE_LAYOUT, s); err != nil {
+			JsonBadRequest(w, ValidationError{fmt.Sprintf(
+				"Invalid open_on: %s should be like 2014-05-10", s)})
+			return nil
+		}
+	}
 	var results []*VExhibition
-	results, err = SearchExhibitions(dr)
+	if near := r.URL.Query().Get("near"); near != "" {
+		var l *Location
+		var radius float64
+		if l, err = ParseLocation(near); err != nil {
+			JsonBadRequest(w, err)
+			return nil
+		}
+		if radius, err = queryRadius(r.URL.Query()); err != nil {
+			JsonBadRequest(w, err)
+			return nil
+		}
+		results, err = SearchExhibitionsNear(dr, l, radius, openOn)
+	} else {
+		results, err = SearchExhibitions(dr, openOn)
+	}
 	if err != nil {
 		return err
 	}
@@ -54,3 +80,134 @@ func (h *ExhibitionHandler) ListByGallery(w http.ResponseWriter, r *http.Request
 	Json(w, res)
 	return nil
 }
+
+// validateContent returns errors of the title and the date range, that are
+// required to write an exhibition.
+func validateContent(e *Exhibition) (err ValidationError) {
+	if strings.TrimSpace(e.Title) == "" {
+		err = err.Append("Invalid title: title should not be empty")
+	}
+	if e.DateRange[0].IsZero() {
+		err = err.Append("Invalid date_range: start should not be empty")
+	} else if !e.DateRange.IsOpen() && e.DateRange[1].Before(e.DateRange[0]) {
+		err = err.Append(fmt.Sprintf(
+			"Invalid date_range: end %s should not be before start %s",
+			e.DateRange[1].Format(DATE_LAYOUT),
+			e.DateRange[0].Format(DATE_LAYOUT)))
+	}
+	return
+}
+
+// saveExhibition decodes the request body into e and saves e by save. It
+// sends e with code, or errors of fields with 400 status.
+func saveExhibition(w http.ResponseWriter, r *http.Request, galleryId, id string, e *Exhibition, save func() error, code int) error {
+	if vError := decodeBody(w, r, e); vError != nil {
+		JsonFieldErrors(w, vError)
+		return nil
+	}
+	var vError ValidationError
+	if e.Id != "" && e.Id != id {
+		vError = vError.Append(fmt.Sprintf(
+			"Invalid id: %s differs from the id of the URL", e.Id))
+	}
+	if e.GalleryId != "" && !strings.EqualFold(e.GalleryId, galleryId) {
+		vError = vError.Append(fmt.Sprintf(
+			"Invalid gallery_id: %s differs from the id of the URL",
+			e.GalleryId))
+	}
+	e.Id, e.GalleryId = id, galleryId
+	vError = append(vError, e.Validate()...)
+	vError = append(vError, validateContent(e)...)
+	if vError != nil {
+		JsonFieldErrors(w, vError)
+		return nil
+	}
+	if err := save(); err != nil {
+		// another request has created it after the check
+		if c, ok := err.(*ConflictError); ok {
+			JsonConflict(w, c.Id)
+			return nil
+		}
+		// another exhibition starts on the same day
+		if vError, ok := err.(ValidationError); ok {
+			JsonFieldErrors(w, vError)
+			return nil
+		}
+		return err
+	}
+	JsonStatus(w, code, e)
+	return nil
+}
+
+// getExhibitionToWrite authorizes r to write exhibitions of the gallery of
+// the URL, and returns ids and the stored exhibition. The exhibition is nil
+// if it doesn't exist. It returns a NotFoundError if the gallery doesn't
+// exist.
+func (h *ExhibitionHandler) getExhibitionToWrite(r *http.Request) (string, string, *Exhibition, error) {
+	galleryId := strings.ToLower(patree.Param(r, h.GalleryIdName))
+	id := patree.Param(r, h.IdName)
+	if err := authorize(r, galleryId); err != nil {
+		return "", "", nil, err
+	}
+	if g, err := GetGallery(galleryId); err != nil {
+		return "", "", nil, err
+	} else if g == nil {
+		return "", "", nil, New404(r.URL.Path)
+	}
+	e, err := GetExhibition(galleryId, id)
+	return galleryId, id, e, err
+}
+
+// Post creates an exhibition. It sends 409 status if the exhibition exists.
+func (h *ExhibitionHandler) Post(w http.ResponseWriter, r *http.Request) error {
+	galleryId, id, old, err := h.getExhibitionToWrite(r)
+	if err != nil {
+		return err
+	} else if old != nil {
+		JsonConflict(w, id)
+		return nil
+	}
+	e := &Exhibition{}
+	return saveExhibition(w, r, galleryId, id, e, e.Create,
+		http.StatusCreated)
+}
+
+// Put creates or replaces an exhibition.
+func (h *ExhibitionHandler) Put(w http.ResponseWriter, r *http.Request) error {
+	galleryId, id, old, err := h.getExhibitionToWrite(r)
+	if err != nil {
+		return err
+	}
+	code := http.StatusOK
+	if old == nil {
+		code = http.StatusCreated
+	}
+	e := &Exhibition{}
+	return saveExhibition(w, r, galleryId, id, e, e.Sync, code)
+}
+
+// Patch updates fields of an exhibition that are in the request body.
+func (h *ExhibitionHandler) Patch(w http.ResponseWriter, r *http.Request) error {
+	galleryId, id, e, err := h.getExhibitionToWrite(r)
+	if err != nil {
+		return err
+	} else if e == nil {
+		return New404(r.URL.Path)
+	}
+	return saveExhibition(w, r, galleryId, id, e, e.Update, http.StatusOK)
+}
+
+// Delete deletes an exhibition.
+func (h *ExhibitionHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	_, _, e, err := h.getExhibitionToWrite(r)
+	if err != nil {
+		return err
+	} else if e == nil {
+		return New404(r.URL.Path)
+	}
+	if err = e.Delete(); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -29,7 +29,7 @@ func MustParseDateRange(start, end string) *dateRange {
 }
 
 func MustTruncateAll() {
-	if _, err := db.Exec(`TRUNCATE exhibition, gallery`); err != nil {
+	if _, err := db.Exec(`TRUNCATE gallery_token, gallery_source, gallery_closure, import_checksum, exhibition, gallery`); err != nil {
 		panic(err)
 	}
 }
@@ -59,7 +59,9 @@ func TestExhibitionMarshaling(t *testing.T) {
 		"gallery_id": "54b818d3-22f0-4f8b-6a04-170405fdb840",
 		"title": "Foo",
 		"description": "baar",
-		"date_range": ["2014-05-10","2014-05-20"]
+		"date_range": ["2014-05-10","2014-05-20"],
+		"alerts": ["closed on 5/12"],
+		"note": "free admission"
 	}`)
 	var m Exhibition
 	var err error
@@ -87,6 +89,8 @@ func GenerateRandomExhibition() *Exhibition {
 	dStart := time.Date(2014, time.Month(random(1, 12)), random(1, 29), 0, 0, 0, 0, time.UTC)
 	dEnd := dStart.AddDate(0, 0, 14)
 	m.DateRange = dateRange{dStart, dEnd}
+	m.Alerts = []string{"Alert for " + m.Title}
+	m.Note = "Note for " + m.Title
 	return m
 }
 
@@ -198,15 +202,24 @@ func TestExhibitionCreate(t *testing.T) {
 	e.DateRange[0] = e.DateRange[0].AddDate(0, -1, 0)
 	e.DateRange[1] = e.DateRange[1].AddDate(0, 1, 0)
 	e.Description = "Updated Description"
+	e.Alerts = nil
+	e.Note = ""
 	if err := SaveAndAssert(e, e.Update); err != nil {
 		t.Fatal(err)
 	}
 
 	e.Description = "Updated Description"
+	e.Alerts = []string{"closed on 5/12", "last day ends at 16:00"}
 	if err := SaveAndAssert(e, e.Sync); err != nil {
 		t.Fatal(err)
 	}
 
+	// permanent exhibition
+	e.DateRange[1] = time.Time{}
+	if err := SaveAndAssert(e, e.Update); err != nil {
+		t.Fatal(err)
+	}
+
 	e = GenerateRandomExhibition()
 	if err := SaveAndAssert(e, e.Sync); err != nil {
 		t.Fatal(err)
@@ -289,7 +302,7 @@ func TestGetExhibitionsByDateRange(t *testing.T) {
 
 	for _, c := range cases {
 		dr := MustParseDateRange(c.start, c.end)
-		results, err := SearchExhibitions(dr)
+		results, err := SearchExhibitions(dr, time.Time{})
 		if err != nil {
 			t.Fatal(err)
 		}
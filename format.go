@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of exhibition files.
+const (
+	FORMAT_CSV  = "csv"
+	FORMAT_TSV  = "tsv"
+	FORMAT_JSON = "json"
+	FORMAT_YAML = "yaml"
+	FORMAT_ICS  = "ics"
+	FORMAT_XLSX = "xlsx"
+)
+
+// formatExtensions maps file extensions to formats.
+var formatExtensions = map[string]string{
+	".csv":  FORMAT_CSV,
+	".tsv":  FORMAT_TSV,
+	".tab":  FORMAT_TSV,
+	".json": FORMAT_JSON,
+	".yaml": FORMAT_YAML,
+	".yml":  FORMAT_YAML,
+	".ics":  FORMAT_ICS,
+	".ical": FORMAT_ICS,
+	".xlsx": FORMAT_XLSX,
+}
+
+// isFormat reports whether format is a supported format.
+func isFormat(format string) bool {
+	for _, f := range formatExtensions {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// exhibitionTable is exhibition data decoded from a file of any format. JSON
+// and YAML are arrays of objects, and keys of objects are in Header.
+type exhibitionTable struct {
+	Header []string
+	// HeaderLine is the line of the header. Zero if the format has no header.
+	HeaderLine int
+	// HasColumns is true if values are at the column of the header.
+	HasColumns bool
+	Rows       []exhibitionRow
+	// Errors are problems found while decoding.
+	Errors ParseErrors
+}
+
+type exhibitionRow struct {
+	Line   int
+	Values []string
+}
+
+// column returns the column number of the i-th item of Header. Zero if the
+// format has no columns.
+func (t *exhibitionTable) column(i int) int {
+	if t.HasColumns {
+		return i + 1
+	}
+	return 0
+}
+
+// decodeExhibitionTable decodes exhibition data of the given format. The first
+// sheet of a workbook is decoded.
+func decodeExhibitionTable(file, format string, r io.Reader) (*exhibitionTable, error) {
+	switch format {
+	case FORMAT_CSV:
+		return decodeCSV(file, r, ',')
+	case FORMAT_TSV:
+		return decodeCSV(file, r, '\t')
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, NoContentError
+	}
+	switch format {
+	case FORMAT_JSON:
+		return decodeJSON(file, b)
+	case FORMAT_YAML:
+		return decodeYAML(file, b)
+	case FORMAT_ICS:
+		return decodeICS(file, b)
+	case FORMAT_XLSX:
+		return decodeXLSX(file, "", b)
+	}
+	return nil, fmt.Errorf("Unsupported format %s", format)
+}
+
+// decodeCSV decodes comma or tab separated values.
+func decodeCSV(file string, reader io.Reader, comma rune) (*exhibitionTable, error) {
+	r := csv.NewReader(reader)
+	r.Comma = comma
+	header, err := r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, NoContentError
+		}
+		return nil, err
+	}
+
+	t := &exhibitionTable{Header: header, HeaderLine: 1, HasColumns: true}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if pErr, ok := err.(*csv.ParseError); ok {
+				t.Errors = t.Errors.Append(file, pErr.Line, pErr.Column,
+					pErr.Err.Error())
+				if pErr.Err == csv.ErrFieldCount {
+					continue
+				}
+				return nil, t.Errors
+			}
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		t.Rows = append(t.Rows, exhibitionRow{line, record})
+	}
+	return t, nil
+}
+
+// decodeJSON decodes an array of objects.
+func decodeJSON(file string, b []byte) (*exhibitionTable, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, ParseErrors{}.Append(file, 1, 0,
+			"exhibitions should be an array of objects")
+	}
+	var objects []map[string]interface{}
+	var lines []int
+	for dec.More() {
+		lines = append(lines, lineAt(b, int(dec.InputOffset())))
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err != nil {
+			return nil, ParseErrors{}.Append(file, lines[len(lines)-1], 0,
+				err.Error())
+		}
+		objects = append(objects, obj)
+	}
+	return objectsToTable(objects, lines), nil
+}
+
+// lineAt returns the line of the first token at or after offset.
+func lineAt(b []byte, offset int) int {
+	for offset < len(b) && strings.IndexByte(" \t\r\n,", b[offset]) != -1 {
+		offset += 1
+	}
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
+
+// decodeYAML decodes a sequence of mappings.
+func decodeYAML(file string, b []byte) (*exhibitionTable, error) {
+	var objects []map[string]interface{}
+	if err := yaml.Unmarshal(b, &objects); err != nil {
+		return nil, ParseErrors{}.Append(file, 0, 0, err.Error())
+	}
+	// items of a top level sequence start with "-" at the beginning of lines
+	var lines []int
+	for i, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
+			lines = append(lines, i+1)
+		}
+	}
+	if len(lines) != len(objects) {
+		lines = nil
+	}
+	return objectsToTable(objects, lines), nil
+}
+
+// objectsToTable makes a table from objects. lines are lines of objects or
+// nil if unknown.
+func objectsToTable(objects []map[string]interface{}, lines []int) *exhibitionTable {
+	t := &exhibitionTable{}
+	keys := make(map[string]bool)
+	for _, obj := range objects {
+		for k := range obj {
+			if !keys[k] {
+				keys[k] = true
+				t.Header = append(t.Header, k)
+			}
+		}
+	}
+	sort.Strings(t.Header)
+	for i, obj := range objects {
+		row := exhibitionRow{Values: make([]string, len(t.Header))}
+		if lines != nil {
+			row.Line = lines[i]
+		}
+		for j, k := range t.Header {
+			row.Values[j] = formatField(obj[k])
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// formatField converts a JSON or YAML value into a CSV like field. Items of
+// an array are separated by new lines.
+func formatField(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return v.Format(DATE_LAYOUT_SLASH)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatField(item)
+		}
+		return strings.Join(items, "\n")
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseExhibitionsFormats(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	csv := `id,タイトル:title,説明:description,開始日:start,最終日:end,alert
+2014-1,新年おめでとう展【後期】,,2014/01/05,2014/01/13,
+2014-2,新春彫刻展,About,2014/01/14,2014/01/20,"closed on 1/15
+last day ends at 16:00"
+`
+	expected, err := ParseExhibitions(galleryId, "2014.csv", FORMAT_CSV,
+		bytes.NewReader([]byte(csv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		FORMAT_TSV: "id\tタイトル:title\t説明:description\t開始日:start\t最終日:end\talert\n" +
+			"2014-1\t新年おめでとう展【後期】\t\t2014/01/05\t2014/01/13\t\n" +
+			"2014-2\t新春彫刻展\tAbout\t2014/01/14\t2014/01/20\t\"closed on 1/15\n" +
+			"last day ends at 16:00\"\n",
+		FORMAT_JSON: `[
+			{"id": "2014-1", "title": "新年おめでとう展【後期】",
+				"start": "2014/01/05", "end": "2014/01/13"},
+			{"id": "2014-2", "title": "新春彫刻展", "description": "About",
+				"start": "2014/01/14", "end": "2014/01/20",
+				"alerts": ["closed on 1/15", "last day ends at 16:00"]}
+		]`,
+		FORMAT_YAML: `
+- id: 2014-1
+  title: 新年おめでとう展【後期】
+  start: 2014/01/05
+  end: 2014/01/13
+- id: 2014-2
+  title: 新春彫刻展
+  description: About
+  start: 2014/01/14
+  end: 2014/01/20
+  alert:
+    - closed on 1/15
+    - last day ends at 16:00
+`,
+	}
+	for format, data := range cases {
+		exhibitions, err := ParseExhibitions(galleryId, "2014."+format, format,
+			bytes.NewReader([]byte(data)))
+		if err != nil {
+			t.Fatalf("%s: %s", format, err.Error())
+		}
+		if !reflect.DeepEqual(expected, exhibitions) {
+			t.Fatalf("%s: Expected %v\n. But got %v instead", format, expected,
+				exhibitions)
+		}
+	}
+}
+
+func TestParseExhibitionsFormatErrors(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	cases := []struct {
+		format   string
+		data     string
+		expected []string
+	}{
+		{FORMAT_JSON, `[
+  {"id": 2014, "title": "新春彫刻展", "start": "2014/01/14", "end": "2014/01/20"},
+  {"id": 2014, "title": "", "start": "2014/01/21", "end": "2014/01/27"}
+]`, []string{
+			`2014.json:3: duplicate id "2014". It is used at line 2`,
+			`2014.json:3: title should not be empty`,
+		}},
+		{FORMAT_JSON, `{"id": "2014-1"}`, []string{
+			`2014.json:1: exhibitions should be an array of objects`,
+		}},
+		{FORMAT_YAML, `- id: 2014-1
+  start: 2014/01/14
+- id: 2014-2
+  title: 光彩画廊コレクション展
+  start: 2014-13-21
+`, []string{
+			`2014.json:1: title should not be empty`,
+			`2014.json:3: Invalid start date: 2014-13-21`,
+		}},
+	}
+	for _, c := range cases {
+		_, err := ParseExhibitions(galleryId, "2014.json", c.format,
+			bytes.NewReader([]byte(c.data)))
+		errs, ok := err.(ParseErrors)
+		if !ok {
+			t.Fatalf("It should return ParseErrors. But got %v", err)
+		}
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		if !reflect.DeepEqual(c.expected, msgs) {
+			t.Fatalf("Expected %q\n. But got %q instead", c.expected, msgs)
+		}
+	}
+
+	for _, format := range []string{FORMAT_JSON, FORMAT_YAML, FORMAT_TSV} {
+		_, err := ParseExhibitions(galleryId, "", format,
+			bytes.NewReader([]byte("\n")))
+		if err != NoContentError {
+			t.Fatalf("%s: It should return NoContentError. But got %v", format,
+				err)
+		}
+	}
+}
+
+func TestExhibitionFileFormat(t *testing.T) {
+	cases := []struct {
+		f        ExhibitionFile
+		expected string
+	}{
+		{ExhibitionFile{Name: "2014.csv"}, FORMAT_CSV},
+		{ExhibitionFile{Name: "2014.TSV"}, FORMAT_TSV},
+		{ExhibitionFile{Name: "2014.json"}, FORMAT_JSON},
+		{ExhibitionFile{Name: "2014.yml"}, FORMAT_YAML},
+		{ExhibitionFile{Name: "http://example.com/2014.yaml?v=2"}, FORMAT_YAML},
+		{ExhibitionFile{Name: "basic.ics"}, FORMAT_ICS},
+		{ExhibitionFile{Name: "2014.xlsx"}, FORMAT_XLSX},
+		{ExhibitionFile{Name: "2014"}, FORMAT_CSV},
+		{ExhibitionFile{Name: "schedule", Format: "JSON"}, FORMAT_JSON},
+	}
+	for _, c := range cases {
+		if format := c.f.format(); format != c.expected {
+			t.Fatalf("%s: Expected %s. But got %s instead", c.f.Name,
+				c.expected, format)
+		}
+	}
+	f := ExhibitionFile{Name: "2014.xml", Format: "xml"}
+	if err := f.Validate(); err == nil {
+		t.Fatal("It should return an error with unsupported format")
+	}
+	f = ExhibitionFile{Name: "2014.csv", Sheet: "2014"}
+	if err := f.Validate(); err == nil {
+		t.Fatal("It should return an error with a sheet of CSV")
+	}
+}
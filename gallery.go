@@ -2,16 +2,21 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // Gallery represents gallery model.
 type Gallery struct {
-	Id    string          `json:"id"`
-	Name  string          `json:"name"`
-	Meta  json.RawMessage `json:"meta,omitempty"`
-	About string          `json:"about,omitempty"`
+	Id      string       `json:"id"`
+	Name    string       `json:"name"`
+	About   string       `json:"about,omitempty"`
+	Address Address      `json:"address"`
+	Hours   OpeningHours `json:"opening_hours"`
+	// Location is nil if it is unknown.
+	Location *Location `json:"location,omitempty"`
+	// Closures are irregular closures in addition to weekly closing days.
+	Closures []Closure `json:"closures,omitempty"`
 }
 
 // Validate returns error if a field value is invalid.
@@ -19,44 +24,99 @@ func (g *Gallery) Validate() (err ValidationError) {
 	if !IsUUID(g.Id) {
 		err = err.Append(fmt.Sprintf("Invalid Id: %s is not an UUID", g.Id))
 	}
+	err = append(err, g.Address.Validate()...)
+	err = append(err, g.Hours.Validate()...)
+	if g.Location != nil {
+		err = append(err, g.Location.Validate()...)
+	}
 	return
 }
 
-// Create insert a row in gallery table.
+// coordinates returns latitude and longitude to store. They are nil if the
+// location is unknown.
+func (g *Gallery) coordinates() (lat, lng interface{}) {
+	if g.Location == nil {
+		return nil, nil
+	}
+	return g.Location.Latitude, g.Location.Longitude
+}
+
+// Create insert a row in gallery table and its closures in a transaction.
 func (g *Gallery) Create() error {
+	return withTransaction(func(tx *sql.Tx) error {
+		return g.CreateWith(tx)
+	})
+}
+
+// CreateWith insert a row in gallery table with q.
+func (g *Gallery) CreateWith(q Querier) error {
 	if err := g.Validate(); err != nil {
 		return err
 	}
-	_, err := db.Exec(`
+	lat, lng := g.coordinates()
+	_, err := q.Exec(`
 		INSERT INTO
-			gallery (id, name, meta, about)
+			gallery (id, name, about, postal_code, prefecture, city,
+				street, open_at, close_at, closed_on, latitude, longitude)
 		VALUES
-			($1, $2, $3, $4)`,
-		g.Id, g.Name, []byte(g.Meta), g.About)
-	return err
+			($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::time,
+				NULLIF($9, '')::time, $10, $11, $12)`,
+		g.Id, g.Name, g.About, g.Address.PostalCode, g.Address.Prefecture,
+		g.Address.City, g.Address.Street, g.Hours.OpenAt, g.Hours.CloseAt,
+		int(g.Hours.ClosedOn), lat, lng)
+	if err != nil {
+		return conflictError(err, "gallery_pkey", g.Id)
+	}
+	return saveClosuresWith(q, g)
 }
 
+// Update update a gallery row and its closures in a transaction.
 func (g *Gallery) Update() error {
+	return withTransaction(func(tx *sql.Tx) error {
+		return g.UpdateWith(tx)
+	})
+}
+
+// UpdateWith update a gallery row with q.
+func (g *Gallery) UpdateWith(q Querier) error {
 	if err := g.Validate(); err != nil {
 		return err
 	}
-	_, err := db.Exec(`
+	lat, lng := g.coordinates()
+	_, err := q.Exec(`
 		UPDATE
 			gallery
 		SET
-			(name, meta, about) = ($2, $3, $4)
+			(name, about, postal_code, prefecture, city, street, open_at,
+				close_at, closed_on, latitude, longitude, updated) =
+			($2, $3, $4, $5, $6, $7, NULLIF($8, '')::time,
+				NULLIF($9, '')::time, $10, $11, $12, now())
 		WHERE
 			id = $1
-	`, g.Id, g.Name, []byte(g.Meta), g.About)
-	return err
+	`, g.Id, g.Name, g.About, g.Address.PostalCode, g.Address.Prefecture,
+		g.Address.City, g.Address.Street, g.Hours.OpenAt, g.Hours.CloseAt,
+		int(g.Hours.ClosedOn), lat, lng)
+	if err != nil {
+		return err
+	}
+	return saveClosuresWith(q, g)
 }
 
+// Sync update if exists. If not create new gallery. It is done in a
+// transaction.
 func (g *Gallery) Sync() error {
+	return withTransaction(func(tx *sql.Tx) error {
+		return g.SyncWith(tx)
+	})
+}
+
+// SyncWith update if exists with q. If not create new gallery.
+func (g *Gallery) SyncWith(q Querier) error {
 	if err := g.Validate(); err != nil {
 		return err
 	}
 	var exists bool
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 		SELECT EXISTS (
 			SELECT 1 FROM gallery WHERE id = $1
 		)
@@ -66,29 +126,247 @@ func (g *Gallery) Sync() error {
 		return err
 	}
 	if exists {
-		err = g.Update()
+		err = g.UpdateWith(q)
 	} else {
-		err = g.Create()
+		err = g.CreateWith(q)
 	}
 	return err
 }
 
+// Delete deletes a gallery, its exhibitions and its import records.
+func (g *Gallery) Delete() error {
+	return withTransaction(func(tx *sql.Tx) error {
+		return g.DeleteWith(tx)
+	})
+}
+
+// DeleteWith deletes a gallery, its exhibitions, its import records and its
+// upload token with q.
+func (g *Gallery) DeleteWith(q Querier) error {
+	if !IsUUID(g.Id) {
+		return ValidationError{
+			fmt.Sprintf("Invalid Id: %s is not an UUID", g.Id)}
+	}
+	for _, table := range []string{"exhibition", "import_checksum",
+		"gallery_source", "gallery_closure", "gallery_token"} {
+		if _, err := q.Exec(`DELETE FROM `+table+` WHERE gallery_id = $1`,
+			g.Id); err != nil {
+			return err
+		}
+	}
+	_, err := q.Exec(`DELETE FROM gallery WHERE id = $1`, g.Id)
+	return err
+}
+
 // GetGallery fetch a row from gallry table.
 func GetGallery(id string) (*Gallery, error) {
+	return GetGalleryWith(db, id)
+}
+
+// galleryColumns are columns of a gallery row that scanGallery scans.
+const galleryColumns = `
+	g.id, g.name, g.about, g.postal_code, g.prefecture, g.city, g.street,
+	COALESCE(to_char(g.open_at, 'HH24:MI'), ''),
+	COALESCE(to_char(g.close_at, 'HH24:MI'), ''), g.closed_on, g.latitude,
+	g.longitude`
+
+// scanGallery scans galleryColumns followed by extra columns.
+func scanGallery(row interface {
+	Scan(dest ...interface{}) error
+}, extra ...interface{}) (*Gallery, error) {
 	g := &Gallery{}
-	err := db.QueryRow(`
-		SELECT
-			id, name, meta, about
+	var closedOn int
+	var lat, lng sql.NullFloat64
+	dest := []interface{}{&g.Id, &g.Name, &g.About, &g.Address.PostalCode,
+		&g.Address.Prefecture, &g.Address.City, &g.Address.Street,
+		&g.Hours.OpenAt, &g.Hours.CloseAt, &closedOn, &lat, &lng}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	g.Hours.ClosedOn = Weekdays(closedOn)
+	if lat.Valid && lng.Valid {
+		g.Location = &Location{lat.Float64, lng.Float64}
+	}
+	return g, nil
+}
+
+// GetGalleryWith fetch a row from gallry table with q.
+func GetGalleryWith(q Querier, id string) (*Gallery, error) {
+	g, err := scanGallery(q.QueryRow(`
+		SELECT`+galleryColumns+`
 		FROM
-			gallery
+			gallery AS g
 		WHERE
 			id = $1`,
-		id).Scan(&g.Id, &g.Name, &g.Meta, &g.About)
-	if err == nil {
-		return g, nil
-	}
+		id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+	if g.Closures, err = listClosuresWith(q, id); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// GallerySummary is a gallery with counts of its exhibitions.
+type GallerySummary struct {
+	*Gallery
+	Updated time.Time `json:"updated"`
+	// Current is the number of exhibitions that are held on the date of the
+	// query.
+	Current int `json:"current_exhibitions"`
+	// Upcoming is the number of exhibitions that start after the date of the
+	// query.
+	Upcoming int `json:"upcoming_exhibitions"`
+}
+
+// gallerySorts maps sort names of galleries to ORDER BY clauses. A name
+// prefixed with "-" is descending.
+var gallerySorts = map[string]string{
+	"name":     "g.name, g.id",
+	"-name":    "g.name DESC, g.id",
+	"updated":  "COALESCE(g.updated, g.created), g.id",
+	"-updated": "COALESCE(g.updated, g.created) DESC, g.id",
+}
+
+// GalleryQuery is a query of galleries.
+type GalleryQuery struct {
+	Offset int
+	Limit  int
+	// Sort is one of "name", "updated" and them prefixed with "-" to sort
+	// descending. Galleries are sorted by name if empty.
+	Sort string
+	// City and Prefecture filter galleries if they are not empty.
+	City       string
+	Prefecture string
+	// Date is the date to count current and upcoming exhibitions.
+	Date time.Time
+}
+
+// Validate returns errors of the query.
+func (q *GalleryQuery) Validate() (err ValidationError) {
+	if q.Offset < 0 {
+		err = err.Append(fmt.Sprintf(
+			"Invalid offset: %d should not be negative", q.Offset))
+	}
+	if q.Limit < 1 || q.Limit > 100 {
+		err = err.Append(fmt.Sprintf(
+			"Invalid limit: %d should be between 1 and 100", q.Limit))
+	}
+	if _, ok := gallerySorts[q.Sort]; q.Sort != "" && !ok {
+		err = err.Append(fmt.Sprintf(
+			"Invalid sort: %s should be one of name, -name, updated and -updated",
+			q.Sort))
+	}
+	return
+}
+
+// ListGalleries returns a page of galleries that match the query, and the
+// number of every matching gallery.
+func ListGalleries(query *GalleryQuery) ([]*GallerySummary, int, error) {
+	if err := query.Validate(); err != nil {
+		return nil, 0, err
+	}
+	order := gallerySorts[query.Sort]
+	if order == "" {
+		order = gallerySorts["name"]
+	}
+
+	var total int
+	err := db.QueryRow(`
+		SELECT
+			count(*)
+		FROM
+			gallery AS g
+		WHERE
+			($1 = '' OR g.city = $1) AND ($2 = '' OR g.prefecture = $2)
+	`, query.City, query.Prefecture).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT`+galleryColumns+`,
+			COALESCE(g.updated, g.created),
+			(SELECT count(*) FROM exhibition AS e
+				WHERE e.gallery_id = g.id AND e.date_range @> $3::date),
+			(SELECT count(*) FROM exhibition AS e
+				WHERE e.gallery_id = g.id AND lower(e.date_range) > $3::date)
+		FROM
+			gallery AS g
+		WHERE
+			($1 = '' OR g.city = $1) AND ($2 = '' OR g.prefecture = $2)
+		ORDER BY
+			`+order+`
+		LIMIT
+			$4
+		OFFSET
+			$5
+	`, query.City, query.Prefecture, query.Date.Format(DATE_LAYOUT),
+		query.Limit, query.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	results := []*GallerySummary{}
+	for rows.Next() {
+		s := &GallerySummary{}
+		if s.Gallery, err = scanGallery(rows, &s.Updated, &s.Current,
+			&s.Upcoming); err != nil {
+			return nil, 0, err
+		}
+		results = append(results, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// GalleryDistance is a gallery with the distance from a location.
+type GalleryDistance struct {
+	*Gallery
+	// Distance is in kilometers.
+	Distance float64 `json:"distance"`
+}
+
+// NearGalleries returns galleries within radius kilometers of l ordered by
+// distance. Galleries without location are excluded.
+func NearGalleries(l *Location, radius float64, limit int) ([]*GalleryDistance, error) {
+	rows, err := db.Query(`
+		SELECT
+			*
+		FROM (
+			SELECT`+galleryColumns+`, `+distanceSQL("$1", "$2")+` AS distance
+			FROM
+				gallery AS g
+			WHERE
+				g.latitude IS NOT NULL AND g.longitude IS NOT NULL
+		) AS near
+		WHERE
+			distance <= $3
+		ORDER BY
+			distance, id
+		LIMIT
+			$4
+	`, l.Latitude, l.Longitude, radius, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []*GalleryDistance{}
+	for rows.Next() {
+		d := &GalleryDistance{}
+		if d.Gallery, err = scanGallery(rows, &d.Distance); err != nil {
+			return nil, err
+		}
+		results = append(results, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"github.com/smagch/patree"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Gallery
@@ -21,3 +26,261 @@ func (h *GalleryHandler) Get(w http.ResponseWriter, r *http.Request) error {
 	Json(w, g)
 	return nil
 }
+
+// queryInt returns an integer parameter of a query, or def if it is empty.
+func queryInt(v url.Values, name string, def int) (int, error) {
+	s := v.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s is not an integer", name, s)
+	}
+	return n, nil
+}
+
+// parseGalleryQuery parses query parameters offset, limit, sort, city and
+// prefecture.
+func parseGalleryQuery(v url.Values) (q *GalleryQuery, vError ValidationError) {
+	q = &GalleryQuery{
+		Sort:       v.Get("sort"),
+		City:       v.Get("city"),
+		Prefecture: v.Get("prefecture"),
+		Date:       time.Now(),
+	}
+	var err error
+	if q.Offset, err = queryInt(v, "offset", 0); err != nil {
+		vError = vError.Append(err.Error())
+	}
+	if q.Limit, err = queryInt(v, "limit", 20); err != nil {
+		vError = vError.Append(err.Error())
+	}
+	if vError != nil {
+		return nil, vError
+	}
+	if vError = q.Validate(); vError != nil {
+		return nil, vError
+	}
+	return q, nil
+}
+
+// List send a page of galleries with counts of their current and upcoming
+// exhibitions. Query parameters are offset, limit up to 100, sort, city and
+// prefecture.
+func (h *GalleryHandler) List(w http.ResponseWriter, r *http.Request) error {
+	q, vError := parseGalleryQuery(r.URL.Query())
+	if vError != nil {
+		JsonBadRequest(w, vError)
+		return nil
+	}
+	results, total, err := ListGalleries(q)
+	if err != nil {
+		return err
+	}
+	Json(w, &ListResponse{Results: results, Total: total})
+	return nil
+}
+
+// Default and maximum radius of searches by location in kilometers.
+const (
+	defaultRadius = 5.0
+	maxRadius     = 100.0
+)
+
+// queryRadius returns the radius parameter of a query in kilometers.
+func queryRadius(v url.Values) (float64, error) {
+	s := v.Get("radius")
+	if s == "" {
+		return defaultRadius, nil
+	}
+	radius, err := strconv.ParseFloat(s, 64)
+	if err != nil || radius <= 0 || radius > maxRadius {
+		return 0, ValidationError{fmt.Sprintf(
+			"Invalid radius: %s should be a number up to %v", s, maxRadius)}
+	}
+	return radius, nil
+}
+
+// Near send galleries within radius kilometers of lat and lng ordered by
+// distance.
+func (h *GalleryHandler) Near(w http.ResponseWriter, r *http.Request) error {
+	v := r.URL.Query()
+	l, err := parseLatLng(v.Get("lat"), v.Get("lng"))
+	if err != nil {
+		JsonBadRequest(w, err)
+		return nil
+	}
+	radius, err := queryRadius(v)
+	if err != nil {
+		JsonBadRequest(w, err)
+		return nil
+	}
+	results, err := NearGalleries(l, radius, 100)
+	if err != nil {
+		return err
+	}
+	Json(w, &ListResponse{Results: results})
+	return nil
+}
+
+// queryOpenAt returns the at parameter of a query in the time zone of
+// galleries. withHours is false if it is a date without time. It is now if
+// the parameter is omitted.
+func queryOpenAt(v url.Values, now time.Time) (at time.Time, withHours bool, err error) {
+	s := v.Get("at")
+	if s == "" {
+		return now.In(galleryTimeZone), true, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if at, err = time.ParseInLocation(layout, s, galleryTimeZone); err == nil {
+			return at, true, nil
+		}
+	}
+	if at, err = time.ParseInLocation(DATE_LAYOUT, s, galleryTimeZone); err == nil {
+		return at, false, nil
+	}
+	return at, false, ValidationError{fmt.Sprintf(
+		"Invalid at: %s should be like 2014-05-10T15:00 or 2014-05-10", s)}
+}
+
+// Open send galleries that are open at the time of the at parameter, or on
+// the date if it has no time.
+func (h *GalleryHandler) Open(w http.ResponseWriter, r *http.Request) error {
+	at, withHours, err := queryOpenAt(r.URL.Query(), time.Now())
+	if err != nil {
+		JsonBadRequest(w, err)
+		return nil
+	}
+	results, err := OpenGalleries(at, withHours)
+	if err != nil {
+		return err
+	}
+	Json(w, &ListResponse{Results: results})
+	return nil
+}
+
+// Checksums send checksums of files that are imported for a gallery.
+func (h *GalleryHandler) Checksums(w http.ResponseWriter, r *http.Request) error {
+	id := patree.Param(r, h.IdName)
+	g, err := GetGallery(id)
+	if err != nil {
+		return err
+	} else if g == nil {
+		return New404(r.URL.Path)
+	}
+	results, err := ListChecksums(id)
+	if err != nil {
+		return err
+	}
+	Json(w, &ListResponse{Results: results})
+	return nil
+}
+
+// Source send the crawling status of a gallery.
+func (h *GalleryHandler) Source(w http.ResponseWriter, r *http.Request) error {
+	id := patree.Param(r, h.IdName)
+	s, err := GetSource(id)
+	if err != nil {
+		return err
+	} else if s == nil {
+		return New404(r.URL.Path)
+	}
+	Json(w, s)
+	return nil
+}
+
+// saveGallery decodes the request body into g and saves g by save. It sends
+// g with code, or errors of fields with 400 status.
+func saveGallery(w http.ResponseWriter, r *http.Request, id string, g *Gallery, save func() error, code int) error {
+	if vError := decodeBody(w, r, g); vError != nil {
+		JsonFieldErrors(w, vError)
+		return nil
+	}
+	if g.Id != "" && !strings.EqualFold(g.Id, id) {
+		JsonFieldErrors(w, ValidationError{fmt.Sprintf(
+			"Invalid id: %s differs from the id of the URL", g.Id)})
+		return nil
+	}
+	g.Id = id
+	g.Hours.Normalize()
+	if vError := g.Validate(); vError != nil {
+		JsonFieldErrors(w, vError)
+		return nil
+	}
+	if err := save(); err != nil {
+		// another request has created it after the check
+		if c, ok := err.(*ConflictError); ok {
+			JsonConflict(w, c.Id)
+			return nil
+		}
+		return err
+	}
+	JsonStatus(w, code, g)
+	return nil
+}
+
+// getGalleryToWrite authorizes r to write the gallery of the URL, and
+// returns the id and the stored gallery. The gallery is nil if it doesn't
+// exist.
+func (h *GalleryHandler) getGalleryToWrite(r *http.Request) (string, *Gallery, error) {
+	id := strings.ToLower(patree.Param(r, h.IdName))
+	if err := authorize(r, id); err != nil {
+		return "", nil, err
+	}
+	g, err := GetGallery(id)
+	return id, g, err
+}
+
+// Post creates a gallery. It sends 409 status if the gallery exists.
+func (h *GalleryHandler) Post(w http.ResponseWriter, r *http.Request) error {
+	id, old, err := h.getGalleryToWrite(r)
+	if err != nil {
+		return err
+	} else if old != nil {
+		JsonConflict(w, id)
+		return nil
+	}
+	g := &Gallery{}
+	return saveGallery(w, r, id, g, g.Create, http.StatusCreated)
+}
+
+// Put creates or replaces a gallery.
+func (h *GalleryHandler) Put(w http.ResponseWriter, r *http.Request) error {
+	id, old, err := h.getGalleryToWrite(r)
+	if err != nil {
+		return err
+	}
+	code := http.StatusOK
+	if old == nil {
+		code = http.StatusCreated
+	}
+	g := &Gallery{}
+	return saveGallery(w, r, id, g, g.Sync, code)
+}
+
+// Patch updates fields of a gallery that are in the request body.
+func (h *GalleryHandler) Patch(w http.ResponseWriter, r *http.Request) error {
+	id, g, err := h.getGalleryToWrite(r)
+	if err != nil {
+		return err
+	} else if g == nil {
+		return New404(r.URL.Path)
+	}
+	return saveGallery(w, r, id, g, g.Update, http.StatusOK)
+}
+
+// Delete deletes a gallery and its exhibitions.
+func (h *GalleryHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	_, g, err := h.getGalleryToWrite(r)
+	if err != nil {
+		return err
+	} else if g == nil {
+		return New404(r.URL.Path)
+	}
+	if err = g.Delete(); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 )
 
 func createRandomGallery() *Gallery {
@@ -17,7 +18,8 @@ func createRandomGallery() *Gallery {
 	i := strconv.Itoa(random(1, 10000))
 	g.Name = "Gallery:" + i
 	g.About = "AboutMe:" + i
-	g.Meta = []byte(`{"location": "Asahikawa City"}`)
+	g.Address = Address{"070-0032", "北海道", "旭川市", "２条通８丁目"}
+	g.Hours = OpeningHours{"10:00", "18:00", 1 << uint(time.Monday)}
 	return g
 }
 
@@ -61,8 +63,11 @@ func TestGalleryMarshaling(t *testing.T) {
 	b := []byte(`{
 		"id": "9fc312ff-2d94-47dd-a643-c69c63294624",
 		"name": "Foobar",
-		"meta": {"location":"Asahikawa City"},
-		"about": "About me"
+		"about": "About me",
+		"address": {"postal_code": "070-0032", "prefecture": "北海道",
+			"city": "旭川市", "street": "２条通８丁目"},
+		"opening_hours": {"open_at": "10:00", "close_at": "18:00",
+			"closed_on": ["sunday", "monday"]}
 	}`)
 
 	var g *Gallery
@@ -91,10 +96,14 @@ func TestCreateGallery(t *testing.T) {
 		t.Fatal(err)
 	}
 	AssertSameGallery(g.Id, g)
+	if err, ok := g.Create().(*ConflictError); !ok || err.Id != g.Id {
+		t.Fatalf("Creating an existing gallery should conflict: %v", err)
+	}
 
 	g.Name = "Updated Gallery Name:" + g.Id
 	g.About = "Updated About:" + g.Id
-	g.Meta = []byte(`{"location":"updated"}`)
+	g.Address.Street = "３条通８丁目"
+	g.Hours = OpeningHours{"", "", 0}
 	if err := g.Update(); err != nil {
 		t.Fatal(err)
 	}
@@ -114,7 +123,8 @@ func TestSyncGallery(t *testing.T) {
 
 	g.Name = "Updated Gallery Name:" + g.Id
 	g.About = "Updated About:" + g.Id
-	g.Meta = []byte(`{"location":"updated"}`)
+	g.Address.Street = "３条通８丁目"
+	g.Hours = OpeningHours{"", "", 0}
 	if err := g.Sync(); err != nil {
 		t.Fatal(err)
 	}
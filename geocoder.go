@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Columns of KEN_ALL.CSV of Japan Post.
+const (
+	kenAllPostalCode = 2
+	kenAllPrefecture = 6
+	kenAllCity       = 7
+	kenAllTown       = 8
+	kenAllColumns    = 15
+)
+
+// kenAllNoTown is the town name of rows for the rest of a city.
+const kenAllNoTown = "以下に掲載がない場合"
+
+// Columns of town level location data, such as 位置参照情報 of MLIT.
+const (
+	townPrefectureColumn = "都道府県名"
+	townCityColumn       = "市区町村名"
+	townTownColumn       = "大字町丁目名"
+	townLatitudeColumn   = "緯度"
+	townLongitudeColumn  = "経度"
+)
+
+// postalEntry is a town of a postal code.
+type postalEntry struct {
+	Prefecture string
+	City       string
+	Town       string
+}
+
+// townLocation is a location of a town. Town is normalized by normalizeTown.
+type townLocation struct {
+	Town     string
+	Location Location
+}
+
+// Geocoder completes addresses and locations of galleries offline by postal
+// code data and town level location data.
+type Geocoder struct {
+	// postalCodes maps postal codes like "0700032" to towns.
+	postalCodes map[string]*postalEntry
+	// cities maps city names to prefectures that have the city.
+	cities map[string][]string
+	// towns maps prefecture and city names joined by a tab to locations of
+	// towns in the city.
+	towns map[string][]*townLocation
+	// sum is the checksum of loaded files.
+	sum string
+}
+
+// NewGeocoder returns an empty geocoder.
+func NewGeocoder() *Geocoder {
+	return &Geocoder{
+		postalCodes: make(map[string]*postalEntry),
+		cities:      make(map[string][]string),
+		towns:       make(map[string][]*townLocation),
+	}
+}
+
+// LoadGeocoder loads KEN_ALL.CSV and optional town level location data.
+// Files are in Shift_JIS or UTF-8.
+func LoadGeocoder(kenAll, towns string) (*Geocoder, error) {
+	gc := NewGeocoder()
+	sums := []string{}
+	load := func(name string, fn func(io.Reader) error) error {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		sums = append(sums, checksum(b))
+		if b, err = decodeText(b, nil); err != nil {
+			return err
+		}
+		if err = fn(bytes.NewReader(b)); err != nil {
+			return fmt.Errorf("%s: %s", name, err.Error())
+		}
+		return nil
+	}
+	if err := load(kenAll, gc.LoadKenAll); err != nil {
+		return nil, err
+	}
+	if towns != "" {
+		if err := load(towns, gc.LoadTowns); err != nil {
+			return nil, err
+		}
+	}
+	gc.sum = checksum([]byte(strings.Join(sums, ",")))
+	return gc, nil
+}
+
+// LoadKenAll loads rows of KEN_ALL.CSV decoded into UTF-8. A town name that
+// is split into several rows by a long note in parentheses is joined, and
+// the note is removed.
+func (gc *Geocoder) LoadKenAll(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = kenAllColumns
+	inNote := false
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if inNote {
+			inNote = !strings.Contains(row[kenAllTown], "）")
+			continue
+		}
+		town := row[kenAllTown]
+		if i := strings.Index(town, "（"); i != -1 {
+			inNote = !strings.Contains(town, "）")
+			town = town[:i]
+		}
+		if town == kenAllNoTown {
+			town = ""
+		}
+		code, pref, city := row[kenAllPostalCode], row[kenAllPrefecture],
+			row[kenAllCity]
+		if _, ok := gc.postalCodes[code]; !ok {
+			gc.postalCodes[code] = &postalEntry{pref, city, town}
+		}
+		if stringIndex(gc.cities[city], pref) == -1 {
+			gc.cities[city] = append(gc.cities[city], pref)
+		}
+	}
+}
+
+// LoadTowns loads town level location data decoded into UTF-8. The first row
+// is a header that has 都道府県名, 市区町村名, 大字町丁目名, 緯度 and 経度.
+// Other columns are ignored.
+func (gc *Geocoder) LoadTowns(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{townPrefectureColumn, townCityColumn,
+		townTownColumn, townLatitudeColumn, townLongitudeColumn} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("column %s is required", name)
+		}
+	}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(row) != len(header) {
+			return fmt.Errorf("line %d should have %d columns", line,
+				len(header))
+		}
+		lat, err := strconv.ParseFloat(row[columns[townLatitudeColumn]], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid latitude", line)
+		}
+		lng, err := strconv.ParseFloat(row[columns[townLongitudeColumn]], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid longitude", line)
+		}
+		key := row[columns[townPrefectureColumn]] + "\t" +
+			row[columns[townCityColumn]]
+		gc.towns[key] = append(gc.towns[key], &townLocation{
+			normalizeTown(row[columns[townTownColumn]]), Location{lat, lng}})
+	}
+}
+
+// kanjiDigits are values of kanji numerals.
+var kanjiDigits = map[rune]int{
+	'〇': 0, '一': 1, '二': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7,
+	'八': 8, '九': 9,
+}
+
+// normalizeTown converts full width digits and kanji numerals up to 99 in a
+// town name into ASCII digits to compare names. e.g. "二条通八丁目" and
+// "２条通８丁目" are "2条通8丁目".
+func normalizeTown(s string) string {
+	var out []rune
+	rs := []rune(normalizeDigits(strings.TrimSpace(s)))
+	for i := 0; i < len(rs); {
+		n, j := 0, i
+		if d, ok := kanjiDigits[rs[j]]; ok {
+			n, j = d, j+1
+		}
+		if j < len(rs) && rs[j] == '十' {
+			if j == i {
+				n = 1
+			}
+			n, j = n*10, j+1
+			if j < len(rs) {
+				if d, ok := kanjiDigits[rs[j]]; ok {
+					n, j = n+d, j+1
+				}
+			}
+		}
+		if j == i {
+			out = append(out, rs[i])
+			i++
+			continue
+		}
+		out = append(out, []rune(strconv.Itoa(n))...)
+		i = j
+	}
+	return string(out)
+}
+
+// matchTown reports whether a normalized street starts with a normalized town
+// name. A town of a chome matches a street of the number and a block such as
+// "銀座1-2-3" for "銀座1丁目".
+func matchTown(street, town string) bool {
+	if strings.HasPrefix(street, town) {
+		return true
+	}
+	base := strings.TrimSuffix(town, "丁目")
+	if base == town || !strings.HasPrefix(street, base) {
+		return false
+	}
+	rest := street[len(base):]
+	return rest == "" || !isDigit([]rune(rest)[0])
+}
+
+// Complete fills in parts of the address that are empty by the postal code,
+// or by the city if there is only one prefecture that has the city. A city at
+// the start of the street is split from the street.
+func (gc *Geocoder) Complete(a *Address) {
+	if a.City == "" {
+		for city := range gc.cities {
+			if len(city) > len(a.City) && strings.HasPrefix(a.Street, city) {
+				a.City = city
+			}
+		}
+		a.Street = strings.TrimPrefix(a.Street, a.City)
+	}
+	if e, ok := gc.postalCodes[strings.Replace(a.PostalCode, "-", "", 1)]; ok {
+		if a.Prefecture == "" {
+			a.Prefecture = e.Prefecture
+		}
+		if a.City == "" {
+			a.City = e.City
+		}
+	}
+	if prefs := gc.cities[a.City]; a.Prefecture == "" && len(prefs) == 1 {
+		a.Prefecture = prefs[0]
+	}
+}
+
+// Locate returns the approximate location of the address. It is the average
+// of towns that the street starts with, or of the town of the postal code, or
+// of every town in the city. It returns nil if the city is unknown.
+func (gc *Geocoder) Locate(a *Address) *Location {
+	towns := gc.towns[a.Prefecture+"\t"+a.City]
+	if len(towns) == 0 {
+		return nil
+	}
+	// the longest town name that the street starts with is the most precise
+	street := normalizeTown(a.Street)
+	var matched []*townLocation
+	for _, t := range towns {
+		if t.Town == "" || !matchTown(street, t.Town) {
+			continue
+		}
+		if len(matched) != 0 && len(t.Town) < len(matched[0].Town) {
+			continue
+		}
+		if len(matched) != 0 && len(t.Town) > len(matched[0].Town) {
+			matched = nil
+		}
+		matched = append(matched, t)
+	}
+	if e, ok := gc.postalCodes[strings.Replace(a.PostalCode, "-", "", 1)]; ok &&
+		len(matched) == 0 && e.Town != "" {
+		town := normalizeTown(e.Town)
+		for _, t := range towns {
+			if strings.HasPrefix(t.Town, town) {
+				matched = append(matched, t)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		matched = towns
+	}
+	l := &Location{}
+	for _, t := range matched {
+		l.Latitude += t.Location.Latitude
+		l.Longitude += t.Location.Longitude
+	}
+	l.Latitude /= float64(len(matched))
+	l.Longitude /= float64(len(matched))
+	return l
+}
+
+// Geocode completes the address of the gallery, and sets the location if it
+// is unknown and the address is located.
+func (gc *Geocoder) Geocode(g *Gallery) {
+	gc.Complete(&g.Address)
+	if g.Location == nil {
+		g.Location = gc.Locate(&g.Address)
+	}
+}
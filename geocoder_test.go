@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func mustLoadGeocoder() *Geocoder {
+	gc, err := LoadGeocoder("fixtures/geocoder/KEN_ALL.CSV",
+		"fixtures/geocoder/towns.csv")
+	if err != nil {
+		panic(err)
+	}
+	return gc
+}
+
+func TestNormalizeTown(t *testing.T) {
+	for s, expected := range map[string]string{
+		"二条通八丁目":  "2条通8丁目",
+		"２条通８丁目":  "2条通8丁目",
+		"銀座十丁目":   "銀座10丁目",
+		"二十三番町":   "23番町",
+		"十二丁目":    "12丁目",
+		"旭ケ丘":     "旭ケ丘",
+		"銀座1-2-3": "銀座1-2-3",
+	} {
+		if n := normalizeTown(s); n != expected {
+			t.Fatalf("%s: Expected %s. But got %s instead", s, expected, n)
+		}
+	}
+}
+
+func TestLoadGeocoder(t *testing.T) {
+	gc := mustLoadGeocoder()
+	for code, expected := range map[string]postalEntry{
+		"0700000": {"北海道", "旭川市", ""},
+		"0700032": {"北海道", "旭川市", "２条通"},
+		"0640941": {"北海道", "札幌市中央区", "旭ケ丘"},
+		"1040061": {"東京都", "中央区", "銀座"},
+	} {
+		e, ok := gc.postalCodes[code]
+		if !ok || *e != expected {
+			t.Fatalf("%s: Expected %v. But got %v instead", code, expected, e)
+		}
+	}
+	if len(gc.postalCodes) != 7 {
+		t.Fatalf("A note split into rows should not be a postal code: %v",
+			gc.postalCodes)
+	}
+	if len(gc.cities["府中市"]) != 2 {
+		t.Fatalf("府中市 should be in 2 prefectures: %v", gc.cities["府中市"])
+	}
+}
+
+func TestGeocode(t *testing.T) {
+	gc := mustLoadGeocoder()
+	cases := []struct {
+		address  string
+		expected Address
+		location *Location
+	}{
+		{"070-0032 旭川市２条通８丁目",
+			Address{"070-0032", "北海道", "旭川市", "２条通８丁目"},
+			&Location{43.770590, 142.365031}},
+		// the average of the towns of the postal code
+		{"070-0032 旭川市", Address{"070-0032", "北海道", "旭川市", ""},
+			&Location{(43.769800 + 43.770590) / 2, (142.363900 + 142.365031) / 2}},
+		{"東京都中央区銀座1-2-3",
+			Address{"", "東京都", "中央区", "銀座1-2-3"},
+			&Location{35.674390, 139.769930}},
+		// the average of the city
+		{"旭川市神楽1条",
+			Address{"", "北海道", "旭川市", "神楽1条"},
+			&Location{(43.769800 + 43.770590 + 43.771700) / 3,
+				(142.363900 + 142.365031 + 142.366800) / 3}},
+		// the prefecture is ambiguous
+		{"府中市宮西町", Address{"", "", "府中市", "宮西町"}, nil},
+	}
+	for _, c := range cases {
+		g := &Gallery{Address: ParseAddress(c.address)}
+		gc.Geocode(g)
+		if g.Address != c.expected {
+			t.Fatalf("%s: Expected %v. But got %v instead", c.address,
+				c.expected, g.Address)
+		}
+		if (c.location == nil) != (g.Location == nil) || (c.location != nil &&
+			(math.Abs(c.location.Latitude-g.Location.Latitude) > 1e-9 ||
+				math.Abs(c.location.Longitude-g.Location.Longitude) > 1e-9)) {
+			t.Fatalf("%s: Expected %v. But got %v instead", c.address,
+				c.location, g.Location)
+		}
+	}
+
+	g := &Gallery{Address: ParseAddress("070-0032 旭川市２条通８丁目"),
+		Location: &Location{43.7706, 142.3650}}
+	gc.Geocode(g)
+	if *g.Location != (Location{43.7706, 142.3650}) {
+		t.Fatalf("A given location should be kept: %v", g.Location)
+	}
+}
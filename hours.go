@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const CLOCK_LAYOUT = "15:04"
+
+// Weekdays is a set of days of the week. The bit of time.Weekday is set for
+// each day.
+type Weekdays uint8
+
+// weekdayNames maps names of days of the week in English and Japanese.
+var weekdayNames = map[string]time.Weekday{}
+
+func init() {
+	ja := []string{"日", "月", "火", "水", "木", "金", "土"}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		weekdayNames[name] = d
+		weekdayNames[name[:3]] = d
+		weekdayNames[ja[d]] = d
+		weekdayNames[ja[d]+"曜"] = d
+		weekdayNames[ja[d]+"曜日"] = d
+	}
+}
+
+var weekdaySeparator = regexp.MustCompile(`[\s,、・/／]+`)
+
+// Has reports whether the set has d.
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w&(1<<uint(d)) != 0
+}
+
+// Days returns days of the set from Sunday.
+func (w Weekdays) Days() []time.Weekday {
+	days := []time.Weekday{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w.Has(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+func (w Weekdays) String() string {
+	names := []string{}
+	for _, d := range w.Days() {
+		names = append(names, strings.ToLower(d.String()))
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseWeekdays parses days of the week separated by commas or spaces. e.g.
+// "monday, tuesday", "Mon Tue" and "月曜日・火曜日".
+func ParseWeekdays(s string) (w Weekdays, err error) {
+	for _, name := range weekdaySeparator.Split(strings.TrimSpace(s), -1) {
+		if name == "" {
+			continue
+		}
+		d, ok := weekdayNames[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("Invalid closed_on: %s is not a day of the week", name)
+		}
+		w |= 1 << uint(d)
+	}
+	return
+}
+
+// MarshalJSON encodes the set as an array of lower case English names.
+func (w Weekdays) MarshalJSON() ([]byte, error) {
+	names := []string{}
+	for _, d := range w.Days() {
+		names = append(names, strings.ToLower(d.String()))
+	}
+	return json.Marshal(names)
+}
+
+// UnmarshalJSON accepts an array of names or a string of names.
+func (w *Weekdays) UnmarshalJSON(b []byte) error {
+	var names []string
+	if len(b) != 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		names = []string{s}
+	} else if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+	*w = 0
+	for _, name := range names {
+		days, err := ParseWeekdays(name)
+		if err != nil {
+			return err
+		}
+		*w |= days
+	}
+	return nil
+}
+
+// OpeningHours is opening hours of a gallery. Times are "15:04" formatted
+// and empty if unknown.
+type OpeningHours struct {
+	OpenAt   string   `json:"open_at"`
+	CloseAt  string   `json:"close_at"`
+	ClosedOn Weekdays `json:"closed_on"`
+}
+
+func (h OpeningHours) String() string {
+	s := h.OpenAt + "-" + h.CloseAt
+	if h.ClosedOn != 0 {
+		s += " closed on " + h.ClosedOn.String()
+	}
+	return s
+}
+
+// parseClock parses a time of a day. Hours can be a single digit.
+func parseClock(s string) (time.Time, error) {
+	return time.Parse("15:04", normalizeDigits(strings.TrimSpace(s)))
+}
+
+// Normalize formats times as "15:04" if they are valid. e.g. "9:00" is
+// "09:00".
+func (h *OpeningHours) Normalize() {
+	if t, err := parseClock(h.OpenAt); err == nil {
+		h.OpenAt = t.Format(CLOCK_LAYOUT)
+	}
+	if t, err := parseClock(h.CloseAt); err == nil {
+		h.CloseAt = t.Format(CLOCK_LAYOUT)
+	}
+}
+
+// Validate returns errors of times. Opening time should be before closing
+// time.
+func (h *OpeningHours) Validate() (err ValidationError) {
+	var open, close time.Time
+	var openErr, closeErr error
+	if h.OpenAt != "" {
+		if open, openErr = time.Parse(CLOCK_LAYOUT, h.OpenAt); openErr != nil {
+			err = err.Append(fmt.Sprintf(
+				"Invalid open_at: %s should be like 10:00", h.OpenAt))
+		}
+	}
+	if h.CloseAt != "" {
+		if close, closeErr = time.Parse(CLOCK_LAYOUT, h.CloseAt); closeErr != nil {
+			err = err.Append(fmt.Sprintf(
+				"Invalid close_at: %s should be like 18:00", h.CloseAt))
+		}
+	}
+	if h.OpenAt != "" && h.CloseAt != "" && openErr == nil &&
+		closeErr == nil && !open.Before(close) {
+		err = err.Append(fmt.Sprintf(
+			"Invalid open_at: %s should be before close_at %s", h.OpenAt,
+			h.CloseAt))
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseWeekdays(t *testing.T) {
+	expected := Weekdays(1<<uint(time.Monday) | 1<<uint(time.Sunday))
+	for _, s := range []string{
+		"monday, sunday",
+		"Sun Mon",
+		"月曜日・日曜日",
+		"月、日",
+	} {
+		w, err := ParseWeekdays(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != expected {
+			t.Fatalf("%s: Expected %s. But got %s instead", s, expected, w)
+		}
+	}
+	if _, err := ParseWeekdays("holiday"); err == nil {
+		t.Fatal("holiday should be an error")
+	}
+}
+
+func TestWeekdaysMarshaling(t *testing.T) {
+	var w Weekdays
+	if err := json.Unmarshal([]byte(`["Monday", "火曜"]`), &w); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `["monday","tuesday"]` {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+	if b, _ = json.Marshal(Weekdays(0)); string(b) != `[]` {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+}
+
+func TestOpeningHoursValidate(t *testing.T) {
+	h := &OpeningHours{OpenAt: "9:00", CloseAt: "18:00"}
+	h.Normalize()
+	if h.OpenAt != "09:00" {
+		t.Fatalf("9:00 should be normalized: %s", h.OpenAt)
+	}
+	if err := h.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []*OpeningHours{
+		{OpenAt: "18:00", CloseAt: "10:00"},
+		{OpenAt: "10:00", CloseAt: "10:00"},
+		{OpenAt: "10am"},
+		{CloseAt: "25:00"},
+	} {
+		if err := h.Validate(); len(err) != 1 {
+			t.Fatalf("%v should have an error: %v", h, err)
+		}
+	}
+}
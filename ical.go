@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ICAL_DATE_LAYOUT      = "20060102"
+	ICAL_DATETIME_LAYOUT  = "20060102T150405"
+	ICAL_DATETIME_LAYOUTZ = "20060102T150405Z"
+)
+
+// icalProperty is a content line of iCalendar. e.g.
+// "DTSTART;VALUE=DATE:20140105"
+type icalProperty struct {
+	Line   int
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// unfoldICS splits iCalendar data into content lines. A line that starts with
+// a space or a tab continues the previous line. It returns the line number
+// of each content line.
+func unfoldICS(b []byte) (lines []string, numbers []int) {
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	for i, line := range strings.Split(string(b), "\n") {
+		if len(lines) != 0 && (strings.HasPrefix(line, " ") ||
+			strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+		numbers = append(numbers, i+1)
+	}
+	return
+}
+
+// parseICSProperty parses a content line. Parameter values can be quoted.
+func parseICSProperty(line string) (*icalProperty, bool) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon == -1 {
+		return nil, false
+	}
+	p := &icalProperty{Params: make(map[string]string), Value: line[colon+1:]}
+	parts := strings.Split(line[:colon], ";")
+	p.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if i := strings.Index(param, "="); i != -1 {
+			p.Params[strings.ToUpper(param[:i])] = strings.Trim(param[i+1:], `"`)
+		}
+	}
+	return p, true
+}
+
+var icalEscape = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",",
+	`\;`, ";", `\\`, `\`)
+
+// unescapeICSText decodes a TEXT value.
+func unescapeICSText(s string) string {
+	return icalEscape.Replace(s)
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. It reports whether the value
+// is a DATE. UTC times are converted into loc if it is not nil.
+func parseICSTime(p *icalProperty, loc *time.Location) (t time.Time, isDate bool, err error) {
+	v := strings.TrimSpace(p.Value)
+	if p.Params["VALUE"] == "DATE" || len(v) == len(ICAL_DATE_LAYOUT) {
+		t, err = time.Parse(ICAL_DATE_LAYOUT, v)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		if t, err = time.Parse(ICAL_DATETIME_LAYOUTZ, v); err == nil && loc != nil {
+			t = t.In(loc)
+		}
+		return
+	}
+	// floating time or time with TZID, which is already local
+	t, err = time.Parse(ICAL_DATETIME_LAYOUT, v)
+	return
+}
+
+var icalDuration = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?`)
+
+// parseICSDays returns the number of days of a DURATION value. Times in the
+// duration are ignored.
+func parseICSDays(s string) (int, bool) {
+	m := icalDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return 0, false
+	}
+	weeks, _ := strconv.Atoi(m[1])
+	days, _ := strconv.Atoi(m[2])
+	return weeks*7 + days, true
+}
+
+// decodeICS decodes VEVENTs of iCalendar data. UID is the id, SUMMARY is the
+// title and DESCRIPTION is the description. DTEND of an all-day event is
+// exclusive, so the last day is the day before DTEND. An event without DTEND
+// and DURATION is a single day event. Cancelled events, recurrence rules and
+// overridden recurrences are ignored.
+func decodeICS(file string, b []byte) (*exhibitionTable, error) {
+	t := &exhibitionTable{
+		Header: []string{"id", "title", "description", "start", "end"},
+	}
+	lines, numbers := unfoldICS(b)
+
+	var loc *time.Location
+	var event []*icalProperty
+	var eventLine, depth int
+	for i, line := range lines {
+		p, ok := parseICSProperty(line)
+		if !ok {
+			t.Errors = t.Errors.Append(file, numbers[i], 0,
+				"invalid content line: "+line)
+			continue
+		}
+		p.Line = numbers[i]
+		switch {
+		case p.Name == "X-WR-TIMEZONE":
+			// timezone of a calendar exported by Google Calendar
+			if l, err := time.LoadLocation(strings.TrimSpace(p.Value)); err == nil {
+				loc = l
+			}
+		case p.Name == "BEGIN" && strings.ToUpper(p.Value) == "VEVENT":
+			event, eventLine, depth = []*icalProperty{}, p.Line, 1
+		case event == nil:
+			// outside of VEVENT
+		case p.Name == "BEGIN":
+			depth += 1
+		case p.Name == "END":
+			depth -= 1
+			if depth == 0 {
+				if row, ok := icsEventRow(event, loc); ok {
+					row.Line = eventLine
+					t.Rows = append(t.Rows, row)
+				}
+				event = nil
+			}
+		case depth == 1:
+			// properties of nested components such as VALARM are ignored
+			event = append(event, p)
+		}
+	}
+	if len(t.Rows) == 0 && t.Errors == nil {
+		return nil, NoContentError
+	}
+	return t, nil
+}
+
+// icsEventRow makes a row from properties of a VEVENT.
+func icsEventRow(event []*icalProperty, loc *time.Location) (exhibitionRow, bool) {
+	props := make(map[string]*icalProperty)
+	for _, p := range event {
+		props[p.Name] = p
+	}
+	if p, ok := props["STATUS"]; ok && strings.ToUpper(p.Value) == "CANCELLED" {
+		return exhibitionRow{}, false
+	}
+	if _, ok := props["RECURRENCE-ID"]; ok {
+		return exhibitionRow{}, false
+	}
+
+	values := make([]string, 5)
+	if p, ok := props["UID"]; ok {
+		values[0] = strings.TrimSpace(p.Value)
+	}
+	if p, ok := props["SUMMARY"]; ok {
+		values[1] = unescapeICSText(p.Value)
+	}
+	if p, ok := props["DESCRIPTION"]; ok {
+		values[2] = unescapeICSText(p.Value)
+	}
+
+	var start time.Time
+	var isDate bool
+	var startErr error
+	if p, ok := props["DTSTART"]; ok {
+		if start, isDate, startErr = parseICSTime(p, loc); startErr != nil {
+			// keep the raw value to be reported as an invalid date
+			values[3] = p.Value
+		} else {
+			values[3] = start.Format(DATE_LAYOUT_SLASH)
+		}
+	}
+
+	end := start
+	if p, ok := props["DTEND"]; ok {
+		var endIsDate bool
+		var err error
+		if end, endIsDate, err = parseICSTime(p, loc); err != nil {
+			values[4] = p.Value
+			return exhibitionRow{Values: values}, true
+		}
+		// DTEND is exclusive, but a zero length event is still a day
+		midnight := end.Hour() == 0 && end.Minute() == 0 && end.Second() == 0
+		if end.After(start) && (endIsDate || midnight) {
+			end = end.AddDate(0, 0, -1)
+		}
+	} else if p, ok := props["DURATION"]; ok {
+		if days, ok := parseICSDays(p.Value); ok && days > 0 {
+			end = start.AddDate(0, 0, days)
+			if isDate {
+				end = end.AddDate(0, 0, -1)
+			}
+		}
+	}
+	if values[3] == "" || (startErr != nil && end.IsZero()) {
+		return exhibitionRow{Values: values}, true
+	}
+	values[4] = end.Format(DATE_LAYOUT_SLASH)
+	return exhibitionRow{Values: values}, true
+}
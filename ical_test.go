@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExhibitionsICS(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	ics := strings.Replace(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Google Inc//Google Calendar 70.9054//EN
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20140105
+DTEND;VALUE=DATE:20140114
+UID:2014-1@example.com
+SUMMARY:新年おめでとう展【後期】
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:This is an alarm
+TRIGGER:-P1D
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20140114T100000
+DTEND:20140120T160000
+UID:2014-2@example.com
+SUMMARY:新春彫刻展
+DESCRIPTION:About\, the exhibition\nsecond line. This line is folded a
+ t 75 octets.
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20140121
+UID:2014-3@example.com
+SUMMARY:Opening party
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20140122
+DURATION:P1W
+UID:2014-4@example.com
+SUMMARY:光彩画廊コレクション展
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20140122
+DTEND;VALUE=DATE:20140123
+UID:2014-5@example.com
+SUMMARY:Cancelled
+STATUS:CANCELLED
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n", -1)
+
+	exhibitions, err := ParseExhibitions(galleryId, "basic.ics", FORMAT_ICS,
+		bytes.NewReader([]byte(ics)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		id, title, description, start, end string
+	}{
+		{"2014-1@example.com", "新年おめでとう展【後期】", "", "2014/01/05", "2014/01/13"},
+		{"2014-2@example.com", "新春彫刻展",
+			"About, the exhibition\nsecond line. This line is folded at 75 octets.",
+			"2014/01/14", "2014/01/20"},
+		{"2014-3@example.com", "Opening party", "", "2014/01/21", "2014/01/21"},
+		{"2014-4@example.com", "光彩画廊コレクション展", "", "2014/01/22", "2014/01/28"},
+	}
+	if len(exhibitions) != len(expected) {
+		t.Fatalf("Expected %d exhibitions. But got %d", len(expected),
+			len(exhibitions))
+	}
+	for i, e := range expected {
+		ex := exhibitions[i]
+		actual := []string{ex.Id, ex.Title, ex.Description,
+			ex.DateRange[0].Format(DATE_LAYOUT_SLASH),
+			ex.DateRange[1].Format(DATE_LAYOUT_SLASH)}
+		want := []string{e.id, e.title, e.description, e.start, e.end}
+		if !reflect.DeepEqual(want, actual) {
+			t.Fatalf("Expected %q\n. But got %q instead", want, actual)
+		}
+	}
+}
+
+func TestParseExhibitionsICSErrors(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	ics := `BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:2014-1
+SUMMARY:新春彫刻展
+DTSTART:2014-13-14
+DTEND;VALUE=DATE:20140121
+END:VEVENT
+BEGIN:VEVENT
+UID:2014-1
+SUMMARY:
+DTSTART;VALUE=DATE:20140121
+END:VEVENT
+END:VCALENDAR
+`
+	_, err := ParseExhibitions(galleryId, "basic.ics", FORMAT_ICS,
+		bytes.NewReader([]byte(ics)))
+	errs, ok := err.(ParseErrors)
+	if !ok {
+		t.Fatalf("It should return ParseErrors. But got %v", err)
+	}
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	expected := []string{
+		`basic.ics:2: Invalid start date: 2014-13-14`,
+		`basic.ics:8: duplicate id "2014-1". It is used at line 2`,
+		`basic.ics:8: title should not be empty`,
+	}
+	if !reflect.DeepEqual(expected, msgs) {
+		t.Fatalf("Expected %q\n. But got %q instead", expected, msgs)
+	}
+
+	_, err = ParseExhibitions(galleryId, "", FORMAT_ICS,
+		bytes.NewReader([]byte("BEGIN:VCALENDAR\nEND:VCALENDAR\n")))
+	if err != NoContentError {
+		t.Fatalf("It should return NoContentError. But got %v", err)
+	}
+}
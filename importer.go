@@ -1,50 +1,131 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"time"
 )
 
 var NoContentError = errors.New("No Content")
 
 type galleryInput struct {
-	Id          string   `json:"id"`
-	Name        string   `json:"name"`
-	About       string   `json:"about"`
-	Address     string   `json:"address"`
-	OpenAt      string   `json:"open_at"`
-	CloseAt     string   `json:"close_at"`
-	CloseOn     string   `json:"close_on"`
-	Exhibitions []string `json:"exhibitions"`
-}
-
-// TODO log unknown attributes
-func ParseGalleryData(b []byte) (g *Gallery, exhibitions []string, err error) {
+	Id          string           `json:"id"`
+	Name        string           `json:"name"`
+	About       string           `json:"about"`
+	Address     Address          `json:"address"`
+	OpenAt      string           `json:"open_at"`
+	CloseAt     string           `json:"close_at"`
+	ClosedOn    Weekdays         `json:"closed_on"`
+	CloseOn     Weekdays         `json:"close_on"` // former name of closed_on
+	Latitude    *float64         `json:"latitude"`
+	Longitude   *float64         `json:"longitude"`
+	Closures    []Closure        `json:"closures"`
+	Exhibitions []ExhibitionFile `json:"exhibitions"`
+}
+
+// ExhibitionFile is an item of "exhibitions" in gallery JSON. It is either a
+// file name or an object that has the file name and its options.
+//
+//	"2014.csv"
+//	{"file": "2014.csv", "encoding": "shift_jis"}
+//	{"file": "schedule", "format": "json"}
+//	{"file": "2014.xlsx", "sheet": "2014"}
+type ExhibitionFile struct {
+	Name     string `json:"file"`
+	Encoding string `json:"encoding,omitempty"`
+	// Format is one of "csv", "tsv", "json", "yaml", "ics" and "xlsx". It is
+	// detected by the file extension if omitted.
+	Format string `json:"format,omitempty"`
+	// Sheet is the name of the sheet of a workbook. The first sheet is used
+	// if omitted.
+	Sheet string `json:"sheet,omitempty"`
+}
+
+func (f *ExhibitionFile) UnmarshalJSON(b []byte) error {
+	if len(b) != 0 && b[0] == '"' {
+		*f = ExhibitionFile{}
+		return json.Unmarshal(b, &f.Name)
+	}
+	// avoid recursion
+	type exhibitionFile ExhibitionFile
+	return json.Unmarshal(b, (*exhibitionFile)(f))
+}
+
+// Validate checks the file name and options.
+func (f *ExhibitionFile) Validate() (err ValidationError) {
+	if f.Name == "" {
+		err = err.Append("Invalid exhibitions: file should not be empty")
+	}
+	if _, e := lookupEncoding(f.Encoding); e != nil {
+		err = err.Append(fmt.Sprintf("Invalid exhibitions: %s of %s",
+			e.Error(), f.Name))
+	}
+	if f.Format != "" && !isFormat(f.format()) {
+		err = err.Append(fmt.Sprintf(
+			"Invalid exhibitions: Unsupported format %s of %s", f.Format,
+			f.Name))
+	}
+	if f.Sheet != "" && f.format() != FORMAT_XLSX {
+		err = err.Append(fmt.Sprintf(
+			"Invalid exhibitions: sheet is only for xlsx files, but %s is %s",
+			f.Name, f.format()))
+	}
+	return
+}
+
+// format returns the declared format or the format of the file extension.
+// CSV is the default.
+func (f *ExhibitionFile) format() string {
+	if f.Format != "" {
+		return strings.ToLower(f.Format)
+	}
+	name := f.Name
+	if u, err := url.Parse(name); err == nil {
+		name = u.Path
+	}
+	if format, ok := formatExtensions[strings.ToLower(path.Ext(name))]; ok {
+		return format
+	}
+	return FORMAT_CSV
+}
+
+// ParseGalleryData parses gallery JSON. Unknown attributes are ignored. Use
+// CheckGalleryAttributes to find them. Weekly closing days are closed_on, or
+// close_on that is the former name. The address is either a string of a
+// whole address or an object of its parts. Latitude and longitude are
+// optional but should be given together.
+func ParseGalleryData(b []byte) (g *Gallery, exhibitions []ExhibitionFile, err error) {
 	input := &galleryInput{}
 	if err = json.Unmarshal(b, input); err != nil {
 		return
 	}
 
-	meta := map[string]string{
-		"address":  input.Address,
-		"open_at":  input.OpenAt,
-		"close_at": input.CloseAt,
-		"close_on": input.CloseOn,
-	}
-
 	g = &Gallery{
-		Id:    input.Id,
-		Name:  input.Name,
-		About: input.About,
+		Id:      input.Id,
+		Name:    input.Name,
+		About:   input.About,
+		Address: input.Address,
+		Hours: OpeningHours{input.OpenAt, input.CloseAt,
+			input.ClosedOn | input.CloseOn},
+		Closures: input.Closures,
 	}
-	if g.Meta, err = json.Marshal(meta); err != nil {
+	g.Hours.Normalize()
+	switch {
+	case input.Latitude != nil && input.Longitude != nil:
+		g.Location = &Location{*input.Latitude, *input.Longitude}
+	case input.Latitude != nil || input.Longitude != nil:
+		err = ValidationError{
+			"Invalid location: latitude and longitude should be given together"}
 		return
 	}
 
@@ -52,96 +133,182 @@ func ParseGalleryData(b []byte) (g *Gallery, exhibitions []string, err error) {
 	return
 }
 
-func ImportExhibition(galleryId string, reader io.Reader) (exhibitions []Exhibition, err error) {
-	var props []string
-	r := csv.NewReader(reader)
-	if props, err = r.Read(); err != nil {
-		if err == io.EOF {
-			err = NoContentError
-			return
-		}
-		return
+var (
+	// exhibitionColumnsRequired is a list of columns that every exhibition
+	// file must have.
+	exhibitionColumnsRequired = []string{"id", "title", "start"}
+	// exhibitionColumnsOptional is a list of columns that can be omitted.
+	// Exhibitions are single day events without "end".
+	exhibitionColumnsOptional = []string{"end", "description", "alert", "note"}
+	// exhibitionColumnAliases maps former column names. "alerts" and "notes"
+	// are accepted for backward compatibility.
+	exhibitionColumnAliases = map[string]string{
+		"alerts": "alert",
+		"notes":  "note",
 	}
+)
 
-	propsRequired := []string{"id", "title", "description", "start", "end"}
-	propsOptional := []string{"alerts", "notes"}
-	propsAllowed := append(propsRequired, propsOptional...)
-	usedProps := make(map[int]bool)
+// columnName returns the column name of a header cell. A header cell can have
+// a human readable label before a colon. e.g. "タイトル:title"
+func columnName(s string) string {
+	for _, sep := range []string{":", "："} {
+		if i := strings.LastIndex(s, sep); i != -1 {
+			s = s[i+len(sep):]
+		}
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if alias, ok := exhibitionColumnAliases[s]; ok {
+		return alias
+	}
+	return s
+}
 
-	for _, p := range propsAllowed {
-		for i, verboseProp := range props {
-			if strings.HasSuffix(verboseProp, p) {
-				props[i] = p
-				usedProps[i] = true
-				continue
+// parseExhibitionHeader returns indexes of known columns. Unknown columns are
+// ignored. Only "alert" column can appear more than once.
+func parseExhibitionHeader(file string, t *exhibitionTable) (columns map[string][]int, errs ParseErrors) {
+	columns = make(map[string][]int)
+	for i, cell := range t.Header {
+		name := columnName(cell)
+		known := false
+		for _, c := range append(exhibitionColumnsRequired, exhibitionColumnsOptional...) {
+			if c == name {
+				known = true
+				break
 			}
 		}
-		// if p != "alerts" && p != "notes" {
-		// 	return nil, fmt.Errorf("property \"%s\" is required.", p)
-		// }
-	}
-
-	exhibitions = []Exhibition{}
-	for {
-		var record []string
-		if record, err = r.Read(); err != nil {
-			if err == io.EOF {
-				if len(exhibitions) == 0 {
-					err = NoContentError
-				} else {
-					err = nil
-				}
-			}
-			return
+		if !known {
+			continue
+		}
+		if name != "alert" && len(columns[name]) != 0 {
+			errs = errs.Append(file, t.HeaderLine, t.column(i), fmt.Sprintf(
+				"duplicate column \"%s\". It is defined at column %d",
+				name, columns[name][0]+1))
+			continue
 		}
+		columns[name] = append(columns[name], i)
+	}
+	for _, c := range exhibitionColumnsRequired {
+		if len(columns[c]) == 0 {
+			errs = errs.Append(file, t.HeaderLine, 0,
+				fmt.Sprintf("column \"%s\" is required", c))
+		}
+	}
+	return
+}
+
+// ImportExhibition parses CSV formatted exhibition data.
+func ImportExhibition(galleryId string, reader io.Reader) ([]Exhibition, error) {
+	return ParseExhibitionCSV(galleryId, "", reader)
+}
+
+// ParseExhibitionCSV parses CSV formatted exhibition data.
+func ParseExhibitionCSV(galleryId, file string, reader io.Reader) ([]Exhibition, error) {
+	return ParseExhibitions(galleryId, file, FORMAT_CSV, reader)
+}
+
+// ParseExhibitions parses exhibition data of the given format. Every format
+// follows the same rules as CSV. It checks the whole data and returns
+// ParseErrors that contains every problem found in the file with its line
+// and column.
+func ParseExhibitions(galleryId, file, format string, reader io.Reader) ([]Exhibition, error) {
+	t, err := decodeExhibitionTable(file, format, reader)
+	if err != nil {
+		return nil, err
+	}
+	return parseExhibitionTable(galleryId, file, t)
+}
 
-		if record == nil {
-			break
+// parseExhibitionTable makes exhibitions from a decoded table.
+func parseExhibitionTable(galleryId, file string, t *exhibitionTable) ([]Exhibition, error) {
+	var err error
+	columns, errs := parseExhibitionHeader(file, t)
+	errs = append(errs, t.Errors...)
+	get := func(row *exhibitionRow, name string) string {
+		if indexes := columns[name]; len(indexes) != 0 {
+			return row.Values[indexes[0]]
 		}
-		m := make(map[string]interface{})
-		var dateStart, dateEnd string
-		for i, prop := range props {
-			if _, ok := usedProps[i]; !ok {
-				continue
-			}
-			if prop == "start" {
-				dateStart = record[i]
-			} else if prop == "end" {
-				dateEnd = record[i]
-			} else if prop != "alerts" && prop != "notes" {
-				// TODO alerts and notes
-				m[prop] = record[i]
+		return ""
+	}
+	has := func(name string) bool {
+		return len(columns[name]) != 0
+	}
+	column := func(name string) int {
+		if indexes := columns[name]; len(indexes) != 0 {
+			return t.column(indexes[0])
+		}
+		return 0
+	}
+
+	ids := make(map[string]int)
+	exhibitions := []Exhibition{}
+	for i := range t.Rows {
+		row := &t.Rows[i]
+		line := row.Line
+		e := Exhibition{
+			Id:          strings.TrimSpace(get(row, "id")),
+			GalleryId:   galleryId,
+			Title:       strings.TrimSpace(get(row, "title")),
+			Description: get(row, "description"),
+			Note:        get(row, "note"),
+		}
+		for _, i := range columns["alert"] {
+			e.Alerts = append(e.Alerts, splitAlerts(row.Values[i])...)
+		}
+
+		// columns missing in the header are reported once above
+		if has("id") {
+			if e.Id == "" {
+				errs = errs.Append(file, line, column("id"),
+					"id should not be empty")
+			} else if l, ok := ids[e.Id]; ok {
+				errs = errs.Append(file, line, column("id"), fmt.Sprintf(
+					"duplicate id \"%s\". It is used at line %d", e.Id, l))
+			} else {
+				ids[e.Id] = line
 			}
 		}
-		m["date_range"], err = ParseDateRangeBySlash(dateStart, dateEnd)
-		if err != nil {
-			return
+		if has("title") && e.Title == "" {
+			errs = errs.Append(file, line, column("title"),
+				"title should not be empty")
 		}
 
-		var b []byte
-		if b, err = json.Marshal(m); err != nil {
-			return
+		var start, end time.Time
+		if has("start") {
+			if start, err = parseDate(get(row, "start")); err != nil {
+				errs = errs.Append(file, line, column("start"),
+					"Invalid start date: "+get(row, "start"))
+			}
 		}
-		e := Exhibition{}
-		if err = json.Unmarshal(b, &e); err != nil {
-			return
+		// an empty end is a single day, and an open end has no end date
+		switch s := get(row, "end"); {
+		case strings.TrimSpace(s) == "":
+			end = start
+		case isOpenEnd(s):
+		default:
+			if end, err = parseDate(s); err != nil {
+				errs = errs.Append(file, line, column("end"),
+					"Invalid end date: "+s)
+			} else if end.Before(start) {
+				errs = errs.Append(file, line, column("end"),
+					"end date should not be before start date")
+			}
 		}
-		e.GalleryId = galleryId
+		e.DateRange = dateRange{start, end}
 		exhibitions = append(exhibitions, e)
 	}
 
-	return
+	if errs != nil {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Line < errs[j].Line
+		})
+		return nil, errs
+	}
+	if len(exhibitions) == 0 {
+		return nil, NoContentError
+	}
+	return exhibitions, nil
 }
 
-// 1.   make an http request to the url
-// 2.0  Parse and validate the JSON data
-// 2.1  Trim and create a checksum for the data.
-// 2.2  make HEAD requests to the exhibitions url
-// 2.3  return error if exhibition url does not exist.
-// 3.0  Create or update gallery data.
-// 3.1  Create or update exhibition data.
-// func ImportGallery(url string) error {}
-
 func exists(name string) (bool, error) {
 	fi, err := os.Stat(name)
 	if err == nil {
@@ -153,66 +320,397 @@ func exists(name string) (bool, error) {
 	return false, err
 }
 
-// ImportFixture imports data from the given filename. This is a ad-hoc
-// implementation that would be replaced http loading in the future.
+// splitAlerts splits a cell into alerts by line. Blank lines are ignored.
+func splitAlerts(s string) (alerts []string) {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			alerts = append(alerts, line)
+		}
+	}
+	return
+}
+
+// Importer imports gallery data.
+type Importer struct {
+	// DryRun makes the importer compare data without writing anything.
+	DryRun bool
+	// Prune deletes stored exhibitions of a gallery that are no longer in
+	// any of its exhibition files.
+	Prune bool
+	// PruneLimit is the maximum percentage of stored exhibitions of a gallery
+	// that Prune deletes at once. The import fails if more would be deleted.
+	// Zero means no limit.
+	PruneLimit int
+	// Force imports a gallery even if nothing is changed since the last
+	// import.
+	Force bool
+	// Strict makes warnings such as unknown attributes of gallery JSON
+	// errors.
+	Strict bool
+	// Geocoder completes addresses and locations of galleries if it is not
+	// nil.
+	Geocoder *Geocoder
+}
+
+// ImportFixture imports data from the given filename.
 func ImportFixture(filename string) error {
+	_, err := (&Importer{}).ImportFixture(filename)
+	return err
+}
+
+// ImportGallery imports data from the given gallery JSON URL. Exhibition
+// files are resolved relative to the URL.
+func ImportGallery(url string) error {
+	_, err := (&Importer{}).ImportGallery(url)
+	return err
+}
+
+// ImportFixture imports data from the given filename.
+func (im *Importer) ImportFixture(filename string) (*GalleryDiff, error) {
 	if path.Ext(filename) != ".json" {
-		return errors.New("Only JSON files are supported")
+		return nil, errors.New("Only JSON files are supported")
 	}
+	return im.Import(fileLoader{}, filename)
+}
+
+// ImportGallery imports data from the given gallery JSON URL.
+func (im *Importer) ImportGallery(url string) (*GalleryDiff, error) {
+	return im.Import(&httpLoader{}, url)
+}
 
-	file, err := os.Open(filename)
+func readAll(l Loader, name string) ([]byte, error) {
+	rc, err := l.Open(name)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
 
-	var b []byte
-	if b, err = ioutil.ReadAll(file); err != nil {
-		return err
+// Import parses and validates the gallery data and its exhibition files, and
+// then creates or updates gallery and exhibitions that differ from stored
+// ones in a transaction. Nothing is written if any of them fails. It returns
+// the difference that is, or would be with DryRun, applied.
+//
+// The import is skipped unless Force is set if the gallery JSON, every
+// exhibition file and the importer options have the same checksums as the
+// last import. Warnings are in the difference, or returned as a
+// ValidationError with Strict.
+func (im *Importer) Import(l Loader, name string) (*GalleryDiff, error) {
+	return im.ImportFor(l, name, "")
+}
+
+// ImportFor imports the gallery data in the same way as Import, but only if
+// its id is galleryId. Nothing is written for another gallery. Any id is
+// accepted if galleryId is empty.
+func (im *Importer) ImportFor(l Loader, name, galleryId string) (*GalleryDiff, error) {
+	data, err := readGallery(l, name)
+	if err != nil {
+		return nil, err
+	}
+	if galleryId != "" && !strings.EqualFold(data.Gallery.Id, galleryId) {
+		return nil, ValidationError{fmt.Sprintf(
+			"Invalid Id: %s of %s is not the gallery %s", data.Gallery.Id,
+			name, galleryId)}
+	}
+	if im.Strict && data.Warnings != nil {
+		return nil, ValidationError(data.Warnings)
+	}
+	g := data.Gallery
+	if im.Geocoder != nil {
+		im.Geocoder.Geocode(g)
 	}
 
-	var g *Gallery
-	var exhibitions []string
-	if g, exhibitions, err = ParseGalleryData(b); err != nil {
-		return err
+	if !im.Force {
+		stored, err := ListChecksumsWith(db, g.Id)
+		if err != nil {
+			return nil, err
+		}
+		if sameChecksums(stored, im.withChecksum(data.Checksums)) {
+			return data.annotate(&GalleryDiff{GalleryId: g.Id, Name: g.Name,
+				Skipped: true}), nil
+		}
 	}
 
-	if vError := g.Validate(); vError != nil {
-		return vError
+	exhibitions, err := data.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var d *GalleryDiff
+	if im.DryRun {
+		if d, err = diffWith(db, g, exhibitions); err != nil {
+			return nil, err
+		}
+		if !im.Prune {
+			d.keep()
+		}
+		return data.annotate(d), nil
+	}
+
+	// all or nothing
+	err = withTransaction(func(tx *sql.Tx) error {
+		var err error
+		if d, err = diffWith(tx, g, exhibitions); err != nil {
+			return err
+		}
+		// prune first since a new exhibition may start on the same day as a
+		// removed one
+		if im.Prune {
+			if err = im.prune(tx, d); err != nil {
+				return err
+			}
+		} else {
+			d.keep()
+		}
+		if err = applyDiff(tx, d, g, exhibitions); err != nil {
+			return err
+		}
+		return SaveChecksumsWith(tx, g.Id, im.withChecksum(data.Checksums))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.annotate(d), nil
+}
+
+// galleryData is a gallery JSON and its exhibition files read by a Loader.
+type galleryData struct {
+	Gallery *Gallery
+	// Files are exhibition files whose names are resolved by the Loader.
+	Files []ExhibitionFile
+	// Contents of exhibition files
+	Contents [][]byte
+	// Checksums maps names of the gallery JSON and exhibition files listed
+	// in the gallery JSON to checksums.
+	Checksums map[string]string
+	// Warnings are problems that don't stop importing.
+	Warnings []string
+}
+
+// readGallery reads gallery data and every exhibition file of the gallery. It
+// makes sure that every exhibition file exists before reading them.
+func readGallery(l Loader, name string) (*galleryData, error) {
+	b, err := readAll(l, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &galleryData{
+		Checksums: map[string]string{galleryChecksumName: checksum(b)},
+	}
+	if data.Gallery, data.Files, err = ParseGalleryData(b); err != nil {
+		if _, ok := err.(ValidationError); !ok {
+			err = ValidationError{"Invalid gallery JSON: " + err.Error()}
+		}
+		return nil, err
+	}
+	data.Warnings = CheckGalleryAttributes(b)
+
+	vError := data.Gallery.Validate()
+	for _, f := range data.Files {
+		vError = append(vError, f.Validate()...)
+	}
+	if vError != nil {
+		return nil, vError
 	}
 
 	// check existance
-	dirname := path.Dir(filename)
-	for i, name := range exhibitions {
-		exhibitions[i] = path.Join(dirname, name)
+	var missing ValidationError
+	refs := make([]string, len(data.Files))
+	for i, f := range data.Files {
+		refs[i] = f.Name
+		if data.Files[i].Name, err = l.Resolve(name, f.Name); err != nil {
+			return nil, err
+		}
 		var ok bool
-		ok, err = exists(exhibitions[i])
-		if err != nil {
-			return err
+		if ok, err = l.Exists(data.Files[i].Name); err != nil {
+			return nil, err
 		}
 		if !ok {
-			return fmt.Errorf("No such file as %s. File %s does not exists",
-				exhibitions[i], name)
+			missing = missing.Append(fmt.Sprintf(
+				"No such file as %s. File %s does not exists",
+				data.Files[i].Name, f.Name))
+		}
+	}
+	if missing != nil {
+		return nil, missing
+	}
+
+	for i, f := range data.Files {
+		if b, err = readAll(l, f.Name); err != nil {
+			return nil, err
+		}
+		data.Contents = append(data.Contents, b)
+		data.Checksums[refs[i]] = checksum(b)
+	}
+	return data, nil
+}
+
+// annotate sets warnings and checksums of the gallery data to d.
+func (data *galleryData) annotate(d *GalleryDiff) *GalleryDiff {
+	d.Warnings = data.Warnings
+	d.Checksums = data.Checksums
+	return d
+}
+
+// parse parses every exhibition file. Exhibition ids must be unique in the
+// gallery.
+func (data *galleryData) parse() ([]Exhibition, error) {
+	var vError ValidationError
+	exhibitions := []Exhibition{}
+	ids := make(map[string]string)
+	for i, f := range data.Files {
+		list, err := parseExhibitionFile(data.Gallery.Id, f, data.Contents[i])
+		switch err.(type) {
+		case nil:
+		case ParseErrors, ValidationError:
+			return nil, err
+		default:
+			// errors of decoding the file are errors of its data
+			if err == NoContentError {
+				err = errors.New("no exhibition is found")
+			}
+			return nil, ParseErrors{}.Append(f.Name, 0, 0, err.Error())
+		}
+		for _, e := range list {
+			if other, ok := ids[e.Id]; ok {
+				vError = vError.Append(fmt.Sprintf(
+					"Duplicate id %s in %s and %s", e.Id, other, f.Name))
+			}
+			ids[e.Id] = f.Name
 		}
+		exhibitions = append(exhibitions, list...)
 	}
+	if vError != nil {
+		return nil, vError
+	}
+	return exhibitions, nil
+}
+
+// withChecksum returns a copy of checksums of files with the checksum of the
+// importer options that change imported data. A gallery is imported again if
+// they are changed.
+func (im *Importer) withChecksum(checksums map[string]string) map[string]string {
+	geocoder := "none"
+	if im.Geocoder != nil {
+		geocoder = im.Geocoder.sum
+	}
+	options := fmt.Sprintf("prune=%v prune-limit=%d strict=%v geocoder=%s",
+		im.Prune, im.PruneLimit, im.Strict, geocoder)
+	sums := map[string]string{importerChecksumName: checksum([]byte(options))}
+	for name, sum := range checksums {
+		sums[name] = sum
+	}
+	return sums
+}
+
+// sameChecksums reports whether stored checksums are the same as checksums.
+func sameChecksums(stored []*Checksum, checksums map[string]string) bool {
+	if len(stored) != len(checksums) {
+		return false
+	}
+	for _, c := range stored {
+		if sum, ok := checksums[c.Name]; !ok || sum != c.Checksum {
+			return false
+		}
+	}
+	return true
+}
+
+// diffWith compares g and exhibitions with stored ones.
+func diffWith(q Querier, g *Gallery, exhibitions []Exhibition) (*GalleryDiff, error) {
+	old, err := GetGalleryWith(q, g.Id)
+	if err != nil {
+		return nil, err
+	}
+	var oldExhibitions []Exhibition
+	if old != nil {
+		if oldExhibitions, err = ListExhibitionsWith(q, g.Id); err != nil {
+			return nil, err
+		}
+	}
+	return DiffGallery(old, g, oldExhibitions, exhibitions), nil
+}
+
+// PruneLimitError is an error of an import that would delete more
+// exhibitions than the prune limit.
+type PruneLimitError struct {
+	GalleryId string
+	Removed   int
+	Stored    int
+	Percent   int
+	Limit     int
+}
+
+func (err *PruneLimitError) Error() string {
+	return fmt.Sprintf("Refused to delete %d of %d exhibitions of %s (%d%%). "+
+		"It exceeds the prune limit %d%%", err.Removed, err.Stored,
+		err.GalleryId, err.Percent, err.Limit)
+}
 
-	if err = g.Sync(); err != nil {
-		return err
+// prune deletes removed exhibitions unless it exceeds PruneLimit.
+func (im *Importer) prune(q Querier, d *GalleryDiff) error {
+	removed := len(d.Removed)
+	if removed == 0 {
+		return nil
 	}
+	stored := removed + len(d.Changed) + d.Unchanged
+	if percent := removed * 100 / stored; im.PruneLimit > 0 && percent > im.PruneLimit {
+		return &PruneLimitError{d.GalleryId, removed, stored, percent,
+			im.PruneLimit}
+	}
+	for _, e := range d.Removed {
+		if err := e.DeleteWith(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	for _, filename := range exhibitions {
-		var f *os.File
-		if f, err = os.Open(filename); err != nil {
+// applyDiff writes gallery and exhibitions that are created or changed.
+func applyDiff(q Querier, d *GalleryDiff, g *Gallery, exhibitions []Exhibition) error {
+	if d.NewGallery || len(d.Gallery) != 0 {
+		if err := g.SyncWith(q); err != nil {
 			return err
 		}
-		var exList []Exhibition
-		if exList, err = ImportExhibition(g.Id, f); err != nil {
+	}
+	for _, e := range d.Created {
+		if err := e.CreateWith(q); err != nil {
 			return err
 		}
-		for _, e := range exList {
-			if err := e.Sync(); err != nil {
-				return err
-			}
+	}
+	changed := make(map[string]bool)
+	for _, c := range d.Changed {
+		changed[c.Id] = true
+	}
+	for _, e := range exhibitions {
+		if !changed[e.Id] {
+			continue
+		}
+		if err := e.UpdateWith(q); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// parseExhibitionFile parses the content of an exhibition file after
+// transcoding into UTF-8. A workbook is binary and has no encoding.
+func parseExhibitionFile(galleryId string, f ExhibitionFile, b []byte) ([]Exhibition, error) {
+	if f.format() == FORMAT_XLSX {
+		t, err := decodeXLSX(f.Name, f.Sheet, b)
+		if err != nil {
+			return nil, err
+		}
+		return parseExhibitionTable(galleryId, f.Name, t)
+	}
+	enc, err := lookupEncoding(f.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = decodeText(b, enc); err != nil {
+		return nil, err
+	}
+	return ParseExhibitions(galleryId, f.Name, f.format(), bytes.NewReader(b))
+}
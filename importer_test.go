@@ -2,11 +2,15 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseGalleryData(t *testing.T) {
@@ -17,10 +21,10 @@ func TestParseGalleryData(t *testing.T) {
 		"about": "Test",
 		"open_at": "10:00",
 		"close_at": "18:00",
-		"close_on": "",
+		"closed_on": "月曜日・火曜日",
 		"exhibitions": [
 			"2013.csv",
-			"2014.csv"
+			{"file": "2014.csv", "encoding": "shift_jis"}
 		]
 	}`)
 	g, exhibitions, err := ParseGalleryData(b)
@@ -29,23 +33,17 @@ func TestParseGalleryData(t *testing.T) {
 	}
 
 	gExpected := &Gallery{
-		Id:    "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
-		Name:  "ヒラマ画廊",
-		About: "Test",
-		Meta:  []byte{},
-	}
-	exExpected := []string{"2013.csv", "2014.csv"}
-	metaExpected := map[string]string{
-		"open_at":  "10:00",
-		"close_at": "18:00",
-		"close_on": "",
-		"address":  "070-0032 旭川市２条通８丁目",
+		Id:      "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		Name:    "ヒラマ画廊",
+		About:   "Test",
+		Address: Address{"070-0032", "", "旭川市", "２条通８丁目"},
+		Hours: OpeningHours{"10:00", "18:00",
+			1<<uint(time.Monday) | 1<<uint(time.Tuesday)},
 	}
-	meta := map[string]string{}
-	if err := json.Unmarshal(g.Meta, &meta); err != nil {
-		t.Fatal(err)
+	exExpected := []ExhibitionFile{
+		{Name: "2013.csv"},
+		{Name: "2014.csv", Encoding: "shift_jis"},
 	}
-	g.Meta = []byte{}
 
 	if !reflect.DeepEqual(gExpected, g) {
 		t.Fatalf("Expected: %v\nGot %v instead\n", gExpected, g)
@@ -53,8 +51,14 @@ func TestParseGalleryData(t *testing.T) {
 	if !reflect.DeepEqual(exExpected, exhibitions) {
 		t.Fatalf("Expected %v\nGot %v instead\n", exExpected, exhibitions)
 	}
-	if !reflect.DeepEqual(metaExpected, meta) {
-		t.Fatalf("Expected: %v\nGot %v instead\n", metaExpected, meta)
+
+	// close_on is the former name of closed_on
+	g, _, err = ParseGalleryData([]byte(`{"close_on": ["monday", "tuesday"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Hours.ClosedOn != gExpected.Hours.ClosedOn {
+		t.Fatalf("close_on should be accepted: %v", g.Hours.ClosedOn)
 	}
 }
 
@@ -74,13 +78,13 @@ func TestImportExhibition(t *testing.T) {
 	desc := ""
 	expected := []Exhibition{
 		{"2014-1", galleryId, "新年おめでとう展【後期】", desc,
-			*MustParseDateRange("2014-01-05", "2014-01-13")},
+			*MustParseDateRange("2014-01-05", "2014-01-13"), nil, ""},
 		{"2014-2", galleryId, "新春彫刻展", desc,
-			*MustParseDateRange("2014-01-14", "2014-01-20")},
+			*MustParseDateRange("2014-01-14", "2014-01-20"), nil, ""},
 		{"2014-3", galleryId, "光彩画廊コレクション展", desc,
-			*MustParseDateRange("2014-01-21", "2014-01-27")},
+			*MustParseDateRange("2014-01-21", "2014-01-27"), nil, ""},
 		{"2014-4", galleryId, "森清行・河原潤 二人展 二重星", desc,
-			*MustParseDateRange("2014-01-28", "2014-02-03")},
+			*MustParseDateRange("2014-01-28", "2014-02-03"), nil, ""},
 	}
 
 	for i, e := range expected {
@@ -90,6 +94,93 @@ func TestImportExhibition(t *testing.T) {
 	}
 }
 
+func TestImportExhibitionAlertsAndNote(t *testing.T) {
+	b := []byte(`id,title,description,start,end,注意:alert,alert,備考:note
+2014-16,高文連上川地区美術部展 前期,,2014/05/04,2014/05/11,"closed on 5/12
+last day ends at 16:00",,入場無料
+2014-17,高文連上川地区美術部展 後期,,2014/05/12,2014/05/19,,last day ends at 16:00,
+2014-18,大蔵屋 春の茶道具展,,2014/05/20,2014/05/26,,,`)
+
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	exhibitions, err := ImportExhibition(galleryId, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		alerts []string
+		note   string
+	}{
+		{[]string{"closed on 5/12", "last day ends at 16:00"}, "入場無料"},
+		{[]string{"last day ends at 16:00"}, ""},
+		{nil, ""},
+	}
+	for i, c := range cases {
+		e := exhibitions[i]
+		if !reflect.DeepEqual(c.alerts, e.Alerts) || c.note != e.Note {
+			t.Fatalf("Expected %v %q\n. But got %v %q instead", c.alerts, c.note,
+				e.Alerts, e.Note)
+		}
+	}
+
+	// plural headers are accepted
+	b = []byte(`id,title,description,start,end,alerts,notes
+2014-16,高文連上川地区美術部展 前期,,2014/05/04,2014/05/11,closed on 5/12,入場無料`)
+	if exhibitions, err = ImportExhibition(galleryId, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if e := exhibitions[0]; !reflect.DeepEqual(e.Alerts, []string{"closed on 5/12"}) ||
+		e.Note != "入場無料" {
+		t.Fatalf("Unexpected alerts and note: %v %q", e.Alerts, e.Note)
+	}
+}
+
+func TestParseExhibitionCSVErrors(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	cases := []struct {
+		data     string
+		expected []string
+	}{
+		{`id,title,begin,end
+2014-1,新春彫刻展,2014/01/14,2014/01/20`, []string{
+			`2014.csv:1: column "start" is required`,
+		}},
+		{`id,title,タイトル:title,start,end
+2014-1,新春彫刻展,新春彫刻展,2014/01/14,2014/01/20`, []string{
+			`2014.csv:1:3: duplicate column "title". It is defined at column 2`,
+		}},
+		{`id,title,start,end
+2014-1,新春彫刻展,2014/01/14,2014/01/20
+2014-2,,2014/01/21,2014/01/27
+2014-1,猫の絵小品展,2014/03/04,2014/03/10
+,羽賀夏子展,2014/02/04,2014/02/10
+2014-5,羽賀夏子展,2014/02/31,2014/02/03
+2014-6,6X6 写真展,2014/02/18
+2014-7,6X6 写真展,2014/02/24,2014/02/18`, []string{
+			`2014.csv:3:2: title should not be empty`,
+			`2014.csv:4:1: duplicate id "2014-1". It is used at line 2`,
+			`2014.csv:5:1: id should not be empty`,
+			`2014.csv:6:3: Invalid start date: 2014/02/31`,
+			`2014.csv:7:1: wrong number of fields`,
+			`2014.csv:8:4: end date should not be before start date`,
+		}},
+	}
+	for _, c := range cases {
+		_, err := ParseExhibitionCSV(galleryId, "2014.csv",
+			bytes.NewReader([]byte(c.data)))
+		errs, ok := err.(ParseErrors)
+		if !ok {
+			t.Fatalf("It should return ParseErrors. But got %v", err)
+		}
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		if !reflect.DeepEqual(c.expected, msgs) {
+			t.Fatalf("Expected %q\n. But got %q instead", c.expected, msgs)
+		}
+	}
+}
+
 func TestImportExhibitionNoContent(t *testing.T) {
 	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
 	reader := bytes.NewReader([]byte{})
@@ -104,6 +195,24 @@ func TestImportExhibitionNoContent(t *testing.T) {
 	}
 }
 
+func TestGalleryDataParseErrors(t *testing.T) {
+	data := &galleryData{
+		Gallery: &Gallery{Id: "B9FE1506-30C4-4CFF-B73E-99D859199A6D"},
+		Files: []ExhibitionFile{{Name: "2014.csv"},
+			{Name: "2015.xlsx"}},
+	}
+	for _, contents := range [][][]byte{
+		{[]byte(""), []byte("")},
+		{[]byte("id,title,start\n1,a,2014/01/05"), []byte("not a zip")},
+	} {
+		data.Contents = contents
+		_, err := data.parse()
+		if errs, ok := err.(ParseErrors); !ok || len(errs) != 1 {
+			t.Fatalf("It should return a ParseError. But got %v", err)
+		}
+	}
+}
+
 func TestImportFixture(t *testing.T) {
 	if err := OpenTestDb(); err != nil {
 		t.Fatal(err)
@@ -120,3 +229,291 @@ func TestImportFixture(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestImportGallery(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	ts := httptest.NewServer(http.FileServer(http.Dir("fixtures")))
+	defer ts.Close()
+	if err := ImportGallery(ts.URL + "/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	exhibitions, err := ListExhibitionByGallery("b9fe1506-30c4-4cff-b73e-99d859199a6d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 30 {
+		t.Fatalf("It should import 30 exhibitions. But got %d", len(exhibitions))
+	}
+}
+
+func TestImportFixtureRollback(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	galleryId := "b9fe1506-30c4-4cff-b73e-99d859199a6d"
+	files := map[string]string{
+		"gallery.json": `{
+			"id": "` + galleryId + `",
+			"name": "ヒラマ画廊",
+			"exhibitions": ["2013.csv", "2014.csv"]
+		}`,
+		"2013.csv": `id,title,start,end
+2013-1,新年おめでとう展【前期】,2013/01/05,2013/01/13`,
+		// exhibitions of a gallery can't start on the same day
+		"2014.csv": `id,title,start,end
+2014-1,新年おめでとう展【後期】,2014/01/05,2014/01/13
+2014-2,新春彫刻展,2014/01/05,2014/01/20`,
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = ImportFixture(path.Join(dir, "gallery.json")); err == nil {
+		t.Fatal("It should fail with the unique constraint")
+	}
+	g, err := GetGallery(galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g != nil {
+		t.Fatal("Gallery should not be created")
+	}
+	e, err := GetExhibition(galleryId, "2013-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Fatal("Exhibition should not be created")
+	}
+}
+
+func TestImporterDryRun(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+
+	im := &Importer{DryRun: true}
+	d, err := im.ImportFixture("fixtures/hirama/hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.NewGallery || len(d.Created) != 30 {
+		t.Fatalf("Every exhibition should be created: %v", d)
+	}
+	if g, err := GetGallery(d.GalleryId); err != nil || g != nil {
+		t.Fatalf("Dry run should not write anything: %v %v", g, err)
+	}
+
+	if err = ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = im.ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	if !d.IsEmpty() || d.Unchanged != 30 {
+		t.Fatalf("Nothing should be changed: %v", d)
+	}
+}
+
+func TestImporterPrune(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	if err := ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := ioutil.ReadFile("fixtures/hirama/hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "hirama.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ioutil.ReadFile("fixtures/hirama/2014.csv"); err != nil {
+		t.Fatal(err)
+	}
+	// remove the last 2 of 30 exhibitions
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	b = []byte(strings.Join(lines[:len(lines)-2], "\n"))
+	if err = ioutil.WriteFile(path.Join(dir, "2014.csv"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := path.Join(dir, "hirama.json")
+	galleryId := "b9fe1506-30c4-4cff-b73e-99d859199a6d"
+
+	im := &Importer{Prune: true, PruneLimit: 5}
+	if _, err = im.ImportFixture(filename); err == nil {
+		t.Fatal("It should refuse to delete more than 5%")
+	} else if _, ok := err.(*PruneLimitError); !ok {
+		t.Fatalf("It should return a PruneLimitError. But got %v", err)
+	}
+	exhibitions, err := ListExhibitionsWith(db, galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 30 {
+		t.Fatalf("Nothing should be deleted. But got %d", len(exhibitions))
+	}
+
+	im.PruneLimit = 10
+	d, err := im.ImportFixture(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Removed) != 2 {
+		t.Fatalf("2 exhibitions should be removed: %v", d.Removed)
+	}
+	if exhibitions, err = ListExhibitionsWith(db, galleryId); err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 28 {
+		t.Fatalf("2 exhibitions should be deleted. But got %d", len(exhibitions))
+	}
+
+	// replace the last exhibition with a new id that starts on the same day
+	lines = lines[:len(lines)-2]
+	last := lines[len(lines)-1]
+	lines[len(lines)-1] = "2014-renamed" + last[strings.Index(last, ","):]
+	b = []byte(strings.Join(lines, "\n"))
+	if err = ioutil.WriteFile(path.Join(dir, "2014.csv"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = im.ImportFixture(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Removed) != 1 || len(d.Created) != 1 {
+		t.Fatalf("An exhibition should be replaced: %v", d)
+	}
+	if e, err := GetExhibition(galleryId, "2014-renamed"); err != nil || e == nil {
+		t.Fatalf("The new exhibition should be created: %v", err)
+	}
+}
+
+func TestImporterSkipsUnchanged(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	im := &Importer{}
+	d, err := im.ImportFixture("fixtures/hirama/hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Skipped {
+		t.Fatal("The first import should not be skipped")
+	}
+	if d, err = im.ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Skipped {
+		t.Fatal("Unchanged files should be skipped")
+	}
+	im.Force = true
+	if d, err = im.ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	if d.Skipped || d.Unchanged != 30 {
+		t.Fatalf("It should import with Force: %v", d)
+	}
+	im.Force, im.Prune = false, true
+	if d, err = im.ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	if d.Skipped {
+		t.Fatal("It should import again with different options")
+	}
+}
+
+func TestImporterWithChecksum(t *testing.T) {
+	files := map[string]string{galleryChecksumName: "a", "2014.csv": "b"}
+	im := &Importer{Prune: true, PruneLimit: 50}
+	sums := im.withChecksum(files)
+	if len(sums) != 3 || sums["2014.csv"] != "b" || len(files) != 2 {
+		t.Fatalf("It should add the checksum of the importer: %v", sums)
+	}
+	for _, other := range []*Importer{
+		{Prune: false, PruneLimit: 50},
+		{Prune: true, PruneLimit: 10},
+		{Prune: true, PruneLimit: 50, Geocoder: NewGeocoder()},
+	} {
+		if other.withChecksum(files)[importerChecksumName] == sums[importerChecksumName] {
+			t.Fatalf("Checksum of %v should differ", other)
+		}
+	}
+}
+
+func TestImporterStrict(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"gallery.json": `{
+			"id": "b9fe1506-30c4-4cff-b73e-99d859199a6d",
+			"name": "ヒラマ画廊",
+			"adress": "070-0032 旭川市２条通８丁目",
+			"exhibitions": ["2014.csv"]
+		}`,
+		"2014.csv": hiramaCSV,
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := path.Join(dir, "gallery.json")
+	warning := `Unknown attribute "adress". Did you mean "address"?`
+
+	im := &Importer{Strict: true}
+	_, err = im.ImportFixture(name)
+	if vErr, ok := err.(ValidationError); !ok || len(vErr) != 1 || vErr[0] != warning {
+		t.Fatalf("It should return a ValidationError of the warning. But got %v", err)
+	}
+
+	im.Strict = false
+	d, err := im.ImportFixture(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{warning}, d.Warnings) {
+		t.Fatalf("It should return the warning. But got %q", d.Warnings)
+	}
+	if d, err = im.ImportFixture(name); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Skipped || len(d.Warnings) != 1 {
+		t.Fatalf("A skipped import should have the warning: %v", d)
+	}
+}
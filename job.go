@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Statuses of a job.
+const (
+	JOB_QUEUED   = "queued"
+	JOB_RUNNING  = "running"
+	JOB_FINISHED = "finished"
+	JOB_FAILED   = "failed"
+)
+
+// Job is a re-import of a gallery source.
+type Job struct {
+	Id        int        `json:"id"`
+	GalleryId string     `json:"gallery_id"`
+	Status    string     `json:"status"`
+	Queued    time.Time  `json:"queued"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	// Result is the status of the source after the import.
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// JobQueue runs jobs one by one in queued order. A gallery that is already
+// queued and not started yet is not queued again, so a burst of requests
+// makes only one job.
+type JobQueue struct {
+	// History is the number of done jobs to keep.
+	History int
+
+	mu     sync.Mutex
+	lastId int
+	// jobs are every queued, running and kept done jobs in queued order.
+	jobs []*Job
+	// queued are jobs waiting to run.
+	queued []*Job
+	wake   chan struct{}
+}
+
+// NewJobQueue returns a queue that keeps history done jobs.
+func NewJobQueue(history int) *JobQueue {
+	return &JobQueue{History: history, wake: make(chan struct{}, 1)}
+}
+
+// Enqueue queues a job of a gallery. It returns the job that is already
+// queued for the gallery and false if any.
+func (q *JobQueue) Enqueue(galleryId string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.queued {
+		if job.GalleryId == galleryId {
+			return *job, false
+		}
+	}
+	q.lastId += 1
+	job := &Job{
+		Id:        q.lastId,
+		GalleryId: galleryId,
+		Status:    JOB_QUEUED,
+		Queued:    time.Now(),
+	}
+	q.jobs = append(q.jobs, job)
+	q.queued = append(q.queued, job)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return *job, true
+}
+
+// Jobs returns copies of jobs in queued order.
+func (q *JobQueue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// start takes the first queued job and marks it running. It returns nil if
+// no job is queued.
+func (q *JobQueue) start() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.queued) == 0 {
+		return nil
+	}
+	job := q.queued[0]
+	q.queued = q.queued[1:]
+	now := time.Now()
+	job.Status = JOB_RUNNING
+	job.Started = &now
+	return job
+}
+
+// finish marks a job done and forgets old done jobs.
+func (q *JobQueue) finish(job *Job, result string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	job.Finished = &now
+	job.Result = result
+	if err != nil {
+		job.Status = JOB_FAILED
+		job.Error = err.Error()
+	} else {
+		job.Status = JOB_FINISHED
+	}
+
+	done := 0
+	for _, j := range q.jobs {
+		if j.Finished != nil {
+			done += 1
+		}
+	}
+	jobs := q.jobs[:0]
+	for _, j := range q.jobs {
+		if j.Finished != nil && done > q.History {
+			done -= 1
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	q.jobs = jobs
+}
+
+// RunNext runs the first queued job by run, which returns the result of the
+// job. It reports whether a job is run.
+func (q *JobQueue) RunNext(run func(galleryId string) (string, error)) bool {
+	job := q.start()
+	if job == nil {
+		return false
+	}
+	result, err := run(job.GalleryId)
+	q.finish(job, result, err)
+	return true
+}
+
+// Run runs queued jobs until stop is closed.
+func (q *JobQueue) Run(run func(galleryId string) (string, error), stop <-chan struct{}) {
+	for {
+		for q.RunNext(run) {
+		}
+		select {
+		case <-stop:
+			return
+		case <-q.wake:
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJobQueue(t *testing.T) {
+	q := NewJobQueue(2)
+	a, queued := q.Enqueue("a")
+	if !queued || a.Status != JOB_QUEUED {
+		t.Fatalf("a should be queued: %v", a)
+	}
+	if job, queued := q.Enqueue("a"); queued || job.Id != a.Id {
+		t.Fatalf("a should not be queued twice: %v", job)
+	}
+	q.Enqueue("b")
+
+	var run []string
+	runner := func(galleryId string) (string, error) {
+		run = append(run, galleryId)
+		// a push while running queues another job
+		if len(run) <= 2 {
+			if job, queued := q.Enqueue(galleryId); !queued {
+				t.Fatalf("%s should be queued while running: %v",
+					galleryId, job)
+			}
+		}
+		if galleryId == "b" {
+			return SOURCE_FAILED, errors.New("GET b: 404 Not Found")
+		}
+		return SOURCE_IMPORTED, nil
+	}
+	for q.RunNext(runner) {
+		if len(run) > 4 {
+			break
+		}
+	}
+	if len(run) != 4 || run[0] != "a" || run[1] != "b" || run[2] != "a" ||
+		run[3] != "b" {
+		t.Fatalf("Unexpected order of jobs: %v", run)
+	}
+
+	jobs := q.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("Only 2 done jobs should be kept: %v", jobs)
+	}
+	if jobs[0].GalleryId != "a" || jobs[0].Status != JOB_FINISHED ||
+		jobs[0].Result != SOURCE_IMPORTED || jobs[0].Started == nil {
+		t.Fatalf("a should be finished: %v", jobs[0])
+	}
+	if jobs[1].GalleryId != "b" || jobs[1].Status != JOB_FAILED ||
+		jobs[1].Error == "" {
+		t.Fatalf("b should be failed: %v", jobs[1])
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Loader opens gallery and exhibition files by name. Exhibition file names
+// are resolved relative to the gallery JSON that lists them.
+type Loader interface {
+	// Open opens the named file.
+	Open(name string) (io.ReadCloser, error)
+	// Exists reports whether the named file exists.
+	Exists(name string) (bool, error)
+	// Resolve returns the name of ref relative to base.
+	Resolve(base, ref string) (string, error)
+}
+
+// isURL reports whether s is an http or https URL.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// fileLoader loads files from the local file system.
+type fileLoader struct{}
+
+func (l fileLoader) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (l fileLoader) Exists(name string) (bool, error) {
+	return exists(name)
+}
+
+func (l fileLoader) Resolve(base, ref string) (string, error) {
+	return path.Join(path.Dir(base), ref), nil
+}
+
+// mapLoader loads files from memory, such as uploaded files. Names are not
+// resolved, every file is at the same level.
+type mapLoader map[string][]byte
+
+func (l mapLoader) Open(name string) (io.ReadCloser, error) {
+	b, ok := l[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (l mapLoader) Exists(name string) (bool, error) {
+	_, ok := l[name]
+	return ok, nil
+}
+
+func (l mapLoader) Resolve(base, ref string) (string, error) {
+	return ref, nil
+}
+
+// httpClient is the default client to fetch files. A publisher that doesn't
+// respond can't stall imports.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxFetchBytes is the maximum size of a fetched file.
+const maxFetchBytes = 10 << 20
+
+// limitedBody is a response body that fails reading more than n bytes.
+type limitedBody struct {
+	io.ReadCloser
+	name string
+	n    int64
+}
+
+// limitBody limits the body of the named file to maxFetchBytes.
+func limitBody(name string, body io.ReadCloser) io.ReadCloser {
+	return &limitedBody{body, name, maxFetchBytes}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.n {
+		n, b.n = int(b.n), 0
+		return n, fmt.Errorf("GET %s: larger than %d bytes", b.name,
+			maxFetchBytes)
+	}
+	b.n -= int64(n)
+	return n, err
+}
+
+// httpLoader loads files over HTTP.
+type httpLoader struct {
+	Client *http.Client
+}
+
+func (l *httpLoader) client() *http.Client {
+	if l.Client == nil {
+		return httpClient
+	}
+	return l.Client
+}
+
+func (l *httpLoader) Open(name string) (io.ReadCloser, error) {
+	res, err := l.client().Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", name, res.Status)
+	}
+	return limitBody(name, res.Body), nil
+}
+
+// Exists makes a HEAD request to the URL.
+func (l *httpLoader) Exists(name string) (bool, error) {
+	res, err := l.client().Head(name)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusGone:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD %s: %s", name, res.Status)
+}
+
+func (l *httpLoader) Resolve(base, ref string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return u.ResolveReference(r).String(), nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoaderResolve(t *testing.T) {
+	cases := []struct {
+		l        Loader
+		base     string
+		ref      string
+		expected string
+	}{
+		{fileLoader{}, "fixtures/hirama/hirama.json", "2014.csv",
+			"fixtures/hirama/2014.csv"},
+		{fileLoader{}, "fixtures/hirama/hirama.json", "../2014.csv",
+			"fixtures/2014.csv"},
+		{&httpLoader{}, "http://example.com/hirama/hirama.json", "2014.csv",
+			"http://example.com/hirama/2014.csv"},
+		{&httpLoader{}, "http://example.com/hirama/hirama.json", "/data/2014.csv",
+			"http://example.com/data/2014.csv"},
+		{&httpLoader{}, "http://example.com/hirama/hirama.json",
+			"https://cdn.example.com/2014.csv", "https://cdn.example.com/2014.csv"},
+	}
+	for _, c := range cases {
+		name, err := c.l.Resolve(c.base, c.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != c.expected {
+			t.Fatalf("Expected %s. But got %s instead", c.expected, name)
+		}
+	}
+}
+
+func TestHttpLoader(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("fixtures")))
+	defer ts.Close()
+	l := &httpLoader{}
+
+	ok, err := l.Exists(ts.URL + "/hirama/2014.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("2014.csv should exist")
+	}
+	if ok, err = l.Exists(ts.URL + "/hirama/1999.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("1999.csv should not exist")
+	}
+
+	b, err := readAll(l, ts.URL+"/hirama/hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("fixtures/hirama/hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(expected) {
+		t.Fatalf("Expected %s. But got %s instead", expected, b)
+	}
+	if _, err = readAll(l, ts.URL+"/hirama/1999.csv"); err == nil {
+		t.Fatal("It should return an error with 404")
+	}
+}
+
+func TestHttpLoaderLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+	l := &httpLoader{Client: &http.Client{Timeout: 10 * time.Millisecond}}
+	if _, err := readAll(l, ts.URL+"/hirama.json"); err == nil {
+		t.Fatal("It should time out")
+	}
+
+	b := &limitedBody{ioutil.NopCloser(strings.NewReader("abcdef")), "a", 3}
+	if p, err := ioutil.ReadAll(b); err == nil || string(p) != "abc" {
+		t.Fatalf("It should fail reading more than 3 bytes: %s %v", p, err)
+	}
+	b = &limitedBody{ioutil.NopCloser(strings.NewReader("abc")), "a", 3}
+	if p, err := ioutil.ReadAll(b); err != nil || string(p) != "abc" {
+		t.Fatalf("It should read 3 bytes: %s %v", p, err)
+	}
+}
+
+func TestImportGalleryMissingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(path.Join(dir, "gallery.json"), []byte(`{
+		"id": "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		"name": "ヒラマ画廊",
+		"exhibitions": ["2013.csv", "2014.csv"]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	// it should fail before touching the database
+	err = ImportGallery(ts.URL + "/gallery.json")
+	vErr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("It should return ValidationError. But got %v", err)
+	}
+	if len(vErr) != 2 {
+		t.Fatalf("It should report every missing file. But got %v", vErr)
+	}
+}
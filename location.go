@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadius is the mean radius of the earth in kilometers.
+const earthRadius = 6371.0
+
+// Location is a point of latitude and longitude in degrees.
+type Location struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lng"`
+}
+
+// Validate returns errors of latitude and longitude out of range.
+func (l *Location) Validate() (err ValidationError) {
+	if math.IsNaN(l.Latitude) || l.Latitude < -90 || l.Latitude > 90 {
+		err = err.Append(fmt.Sprintf(
+			"Invalid latitude: %v should be between -90 and 90", l.Latitude))
+	}
+	if math.IsNaN(l.Longitude) || l.Longitude < -180 || l.Longitude > 180 {
+		err = err.Append(fmt.Sprintf(
+			"Invalid longitude: %v should be between -180 and 180",
+			l.Longitude))
+	}
+	return
+}
+
+func (l *Location) String() string {
+	return fmt.Sprintf("%v,%v", l.Latitude, l.Longitude)
+}
+
+// ParseLocation parses a location of "lat,lng". e.g. "43.7706,142.3650"
+func ParseLocation(s string) (*Location, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, ValidationError{fmt.Sprintf(
+			"Invalid near: %s should be like 43.7706,142.3650", s)}
+	}
+	return parseLatLng(strings.TrimSpace(parts[0]),
+		strings.TrimSpace(parts[1]))
+}
+
+// parseLatLng parses latitude and longitude and validates them.
+func parseLatLng(lat, lng string) (*Location, error) {
+	var vError ValidationError
+	l := &Location{}
+	var err error
+	if l.Latitude, err = strconv.ParseFloat(lat, 64); err != nil {
+		vError = vError.Append(fmt.Sprintf(
+			"Invalid latitude: %s is not a number", lat))
+	}
+	if l.Longitude, err = strconv.ParseFloat(lng, 64); err != nil {
+		vError = vError.Append(fmt.Sprintf(
+			"Invalid longitude: %s is not a number", lng))
+	}
+	if vError != nil {
+		return nil, vError
+	}
+	if vError = l.Validate(); vError != nil {
+		return nil, vError
+	}
+	return l, nil
+}
+
+// Distance returns the great circle distance to other in kilometers by the
+// haversine formula.
+func (l *Location) Distance(other *Location) float64 {
+	rad := math.Pi / 180
+	dLat := (other.Latitude - l.Latitude) * rad
+	dLng := (other.Longitude - l.Longitude) * rad
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(l.Latitude*rad)*
+		math.Cos(other.Latitude*rad)*math.Pow(math.Sin(dLng/2), 2)
+	// a can slightly exceed 1 by rounding errors near antipodal points
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// distanceSQL returns an SQL expression of the distance in kilometers between
+// the gallery g and the location of placeholders of latitude and longitude.
+// It is the same haversine formula as Distance and doesn't need PostGIS.
+func distanceSQL(lat, lng string) string {
+	return fmt.Sprintf(`(2 * %v * asin(least(1, sqrt(
+		power(sin(radians(g.latitude - %s) / 2), 2) +
+		cos(radians(%s)) * cos(radians(g.latitude)) *
+		power(sin(radians(g.longitude - %s) / 2), 2)))))`,
+		earthRadius, lat, lat, lng)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseLocation(t *testing.T) {
+	l, err := ParseLocation("43.7706, 142.3650")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Latitude != 43.7706 || l.Longitude != 142.3650 {
+		t.Fatalf("Unexpected location: %v", l)
+	}
+	for s, n := range map[string]int{
+		"43.7706":         1,
+		"a,b":             2,
+		"91,142.3650":     1,
+		"43.7706,-180.5":  1,
+		"-91,181":         2,
+		"43.7706,142,365": 1,
+	} {
+		_, err := ParseLocation(s)
+		if vError, ok := err.(ValidationError); !ok || len(vError) != n {
+			t.Fatalf("%s should have %d errors: %v", s, n, err)
+		}
+	}
+}
+
+func TestLocationDistance(t *testing.T) {
+	asahikawa := &Location{43.7627, 142.3582}
+	sapporo := &Location{43.0687, 141.3508}
+	if d := asahikawa.Distance(sapporo); d < 105 || d > 115 {
+		t.Fatalf("Asahikawa should be about 110km from Sapporo: %v", d)
+	}
+	if d := asahikawa.Distance(asahikawa); d != 0 {
+		t.Fatalf("Distance to itself should be 0: %v", d)
+	}
+	antipode := &Location{-43.7627, 142.3582 - 180}
+	if d := asahikawa.Distance(antipode); math.IsNaN(d) || d < 20000 {
+		t.Fatalf("Distance to the antipode should be about 20015km: %v", d)
+	}
+}
+
+func TestParseGalleryDataLocation(t *testing.T) {
+	g, _, err := ParseGalleryData([]byte(`{
+		"id": "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		"latitude": 43.7706,
+		"longitude": 142.3650
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Location == nil || *g.Location != (Location{43.7706, 142.3650}) {
+		t.Fatalf("Unexpected location: %v", g.Location)
+	}
+	g.Location.Latitude = 100
+	if err := g.Validate(); len(err) != 1 {
+		t.Fatalf("Latitude should be invalid: %v", err)
+	}
+	_, _, err = ParseGalleryData([]byte(`{"latitude": 43.7706}`))
+	if err == nil {
+		t.Fatal("Latitude without longitude should be an error")
+	}
+}
+
+func TestNearRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+
+	asahikawa := &Location{43.7627, 142.3582}
+	near := createRandomGallery()
+	near.Location = &Location{43.7706, 142.3650}
+	far := createRandomGallery()
+	far.Location = &Location{43.0687, 141.3508}
+	unknown := createRandomGallery()
+	for _, g := range []*Gallery{near, far, unknown} {
+		if err := g.Create(); err != nil {
+			t.Fatal(err)
+		}
+		e := &Exhibition{Id: "2014-1", GalleryId: g.Id, Title: "新春彫刻展",
+			DateRange: *MustParseDateRange("2014-01-14", "2014-01-20")}
+		if err := e.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	galleries, err := NearGalleries(asahikawa, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(galleries) != 1 || galleries[0].Id != near.Id ||
+		galleries[0].Distance > 2 {
+		t.Fatalf("Only the near gallery should be found: %v", galleries)
+	}
+	if galleries, err = NearGalleries(asahikawa, 200, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(galleries) != 2 || galleries[1].Id != far.Id {
+		t.Fatalf("Galleries should be ordered by distance: %v", galleries)
+	}
+
+	dr := &dateRange{time.Date(2014, 1, 15, 0, 0, 0, 0, time.UTC),
+		time.Date(2014, 1, 15, 0, 0, 0, 0, time.UTC)}
+	exhibitions, err := SearchExhibitionsNear(dr, asahikawa, 200, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 2 || exhibitions[0].Gallery.Id != near.Id ||
+		exhibitions[0].Distance == nil {
+		t.Fatalf("Exhibitions should be ordered by distance: %v", exhibitions)
+	}
+
+	rt := &routeTest{"/galleries/near?%s", []routeCase{
+		{[]string{"lat=43.7627&lng=142.3582"}, 200, nil},
+		{[]string{"lat=43.7627&lng=142.3582&radius=50"}, 200, nil},
+		{[]string{"lat=43.7627"}, 400, nil},
+		{[]string{"lat=43.7627&lng=142.3582&radius=1000"}, 400, nil},
+	}}
+	rt.exec(t)
+	rt = &routeTest{"/exhibitions/2014-01-15?%s", []routeCase{
+		{[]string{"near=43.7627,142.3582"}, 200, nil},
+		{[]string{"near=43.7627"}, 400, nil},
+	}}
+	rt.exec(t)
+}
@@ -2,18 +2,38 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 )
 
 func main() {
 	httpAddr := flag.String("http", ":8080", "http address to listen")
 	postgresUrl := flag.String("postgres-url", "", "postgres url to listen")
-	useImport := flag.Bool("import", false, "use data import instead of server")
+	useImport := flag.Bool("import", false, "import gallery JSON files, directories or URLs instead of server")
+	workers := flag.Int("workers", 4, "the number of galleries to import concurrently, up to max-conn")
 	maxConn := flag.Int("max-conn", 20, "the number of postgres max connection")
+	dryRun := flag.Bool("dry-run", false, "print what import would change without writing")
+	diffFormat := flag.String("diff-format", "text", "dry-run output format, text or json")
+	prune := flag.Bool("prune", false, "delete exhibitions that are removed from exhibition files")
+	force := flag.Bool("force", false, "import galleries even if their files and the prune, strict and geocoder options are unchanged")
+	pruneLimit := flag.Int("prune-limit", 50, "refuse to delete more than this percentage of exhibitions of a gallery, 0 means no limit")
+	watch := flag.Bool("watch", false, "run server and re-import gallery JSON files or directories when they change")
+	watchInterval := flag.Duration("watch-interval", time.Second, "interval of checking files to watch")
+	watchDelay := flag.Duration("watch-delay", 500*time.Millisecond, "time to wait after the last change before re-importing")
+	crawl := flag.Bool("crawl", false, "run server and import registered gallery sources periodically")
+	crawlInterval := flag.Duration("crawl-interval", time.Hour, "default interval of crawling a gallery source")
+	strict := flag.Bool("strict", false, "fail importing galleries that have warnings such as unknown attributes")
+	reportFile := flag.String("report", "", "write a JSON report of import to the file, or stdout with \"-\" unless dry-run")
+	issueToken := flag.String("issue-token", "", "print a new token to upload data of the gallery id and exit")
+	kenAll := flag.String("ken-all", "", "KEN_ALL.CSV of Japan Post to complete addresses of galleries offline")
+	townLocations := flag.String("town-locations", "", "town level location CSV to locate galleries, used with ken-all")
+	issueWebhookSecret := flag.String("issue-webhook-secret", "", "print a new webhook secret of the registered source of the gallery id and exit")
 	flag.Parse()
 
 	if *postgresUrl == "" {
@@ -35,17 +55,144 @@ func main() {
 
 	db.SetMaxOpenConns(*maxConn)
 
+	if *issueToken != "" {
+		token, err := IssueToken(*issueToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(token)
+		os.Exit(0)
+	}
+
+	if *issueWebhookSecret != "" {
+		secret, err := IssueWebhookSecret(*issueWebhookSecret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(secret)
+		os.Exit(0)
+	}
+
+	if *diffFormat != "text" && *diffFormat != "json" {
+		log.Fatalf("Invalid diff format: %s", *diffFormat)
+	}
+
+	if *reportFile == "-" && *dryRun {
+		log.Fatal(`"report -" cannot be used with "dry-run" that writes the diff to stdout`)
+	}
+
+	if *crawl && *dryRun {
+		log.Fatal(`"crawl" option cannot be used with "dry-run"`)
+	}
+
+	if *watch && *watchInterval <= 0 {
+		log.Fatalf("Invalid watch interval: %s should be positive",
+			*watchInterval)
+	}
+
+	if *crawl && *crawlInterval <= 0 {
+		log.Fatalf("Invalid crawl interval: %s should be positive",
+			*crawlInterval)
+	}
+
+	if *townLocations != "" && *kenAll == "" {
+		log.Fatal(`"town-locations" option needs "ken-all"`)
+	}
+	var geocoder *Geocoder
+	if *kenAll != "" {
+		if geocoder, err = LoadGeocoder(*kenAll, *townLocations); err != nil {
+			log.Fatal("Cannot load the geocoder: ", err.Error())
+		}
+	}
+
+	im := &Importer{
+		DryRun:     *dryRun,
+		Prune:      *prune,
+		PruneLimit: *pruneLimit,
+		Force:      *force,
+		Strict:     *strict,
+		Geocoder:   geocoder,
+	}
+	uploadImporter = im
+
 	if *useImport {
-		for _, filepath := range flag.Args() {
-			log.Printf("Importing %s\n", filepath)
-			if err = ImportFixture(filepath); err != nil {
-				log.Fatalf("Failed to import %s: %s", filepath, err.Error())
+		names, err := FindGalleries(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *workers > *maxConn {
+			*workers = *maxConn
+		}
+		log.Printf("Importing %d galleries with %d workers\n", len(names),
+			*workers)
+		started := time.Now()
+		results := im.ImportAll(names, *workers)
+
+		if *dryRun {
+			diffs := []*GalleryDiff{}
+			for _, r := range results {
+				if r.Err != nil {
+					continue
+				}
+				if *diffFormat == "text" {
+					r.Diff.WriteText(os.Stdout)
+				}
+				diffs = append(diffs, r.Diff)
+			}
+			if *diffFormat == "json" {
+				b, err := json.MarshalIndent(diffs, "", "  ")
+				if err != nil {
+					log.Fatal(err)
+				}
+				os.Stdout.Write(append(b, '\n'))
+			}
+		}
+		failed := WriteSummary(os.Stderr, results)
+		if *reportFile != "" {
+			if err := writeReport(*reportFile, NewReport(im, results, started)); err != nil {
+				log.Fatal("Cannot write the report: ", err.Error())
+			}
+		}
+		if !*dryRun {
+			// imported URLs are crawled later
+			if err := RegisterSources(results); err != nil {
+				log.Fatal(err)
+			}
+		}
+		// keep running to watch changes or crawl after the first import
+		if !*watch && !*crawl {
+			if failed != 0 {
 				os.Exit(1)
-			} else {
-				log.Println("Import succeed")
 			}
+			os.Exit(0)
 		}
-		os.Exit(0)
+	}
+
+	if *watch {
+		w := &Watcher{
+			Targets:  flag.Args(),
+			Interval: *watchInterval,
+			Delay:    *watchDelay,
+			Import:   im.ImportFixture,
+			Out:      os.Stderr,
+		}
+		log.Printf("Watching %v\n", w.Targets)
+		go w.Run(nil)
+	}
+
+	c := &Crawler{
+		Importer: im,
+		Interval: *crawlInterval,
+		Out:      os.Stderr,
+	}
+	if *crawl {
+		log.Printf("Crawling gallery sources every %s\n", c.Interval)
+		go c.Run(nil)
+	}
+
+	// re-import sources requested by webhooks
+	if !*dryRun {
+		go webhookJobs.Run(c.CrawlGallery, nil)
 	}
 
 	mux := App()
@@ -53,3 +200,19 @@ func main() {
 	err = http.ListenAndServe(*httpAddr, nil)
 	log.Fatal(err)
 }
+
+// writeReport writes the report to the file, or stdout if name is "-".
+func writeReport(name string, report *Report) error {
+	if name == "-" {
+		return report.WriteJSON(os.Stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = report.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Statuses of a gallery in an import report.
+const (
+	REPORT_IMPORTED = "imported"
+	REPORT_SKIPPED  = "skipped"
+	REPORT_FAILED   = "failed"
+)
+
+// Report is a machine readable result of importing galleries.
+type Report struct {
+	Started    time.Time        `json:"started"`
+	DurationMs int64            `json:"duration_ms"`
+	DryRun     bool             `json:"dry_run"`
+	Total      int              `json:"total"`
+	Imported   int              `json:"imported"`
+	Skipped    int              `json:"skipped"`
+	Failed     int              `json:"failed"`
+	Galleries  []*GalleryReport `json:"galleries"`
+}
+
+// GalleryReport is a result of importing a gallery JSON.
+type GalleryReport struct {
+	// Name is the file name or URL of the gallery JSON.
+	Name      string `json:"name"`
+	GalleryId string `json:"gallery_id,omitempty"`
+	Status    string `json:"status"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	// Deleted is the number of exhibitions deleted by pruning.
+	Deleted    int            `json:"deleted"`
+	Warnings   []string       `json:"warnings"`
+	Errors     []*ReportError `json:"errors"`
+	DurationMs int64          `json:"duration_ms"`
+	// Checksums maps names of the gallery JSON and exhibition files to
+	// their checksums. The gallery JSON has an empty name.
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// ReportError is an error of importing. File, Line and Column are omitted if
+// unknown.
+type ReportError struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// reportErrors splits an error into errors of a report.
+func reportErrors(err error) []*ReportError {
+	switch err := err.(type) {
+	case ParseErrors:
+		errs := make([]*ReportError, len(err))
+		for i, e := range err {
+			errs[i] = &ReportError{e.File, e.Line, e.Column, e.Message}
+		}
+		return errs
+	case ValidationError:
+		errs := make([]*ReportError, len(err))
+		for i, msg := range err {
+			errs[i] = &ReportError{Message: msg}
+		}
+		return errs
+	}
+	return []*ReportError{{Message: err.Error()}}
+}
+
+// NewReport makes a report of results of im started at started.
+func NewReport(im *Importer, results []*ImportResult, started time.Time) *Report {
+	report := &Report{
+		Started:    started,
+		DurationMs: int64(time.Since(started) / time.Millisecond),
+		DryRun:     im.DryRun,
+		Total:      len(results),
+		Galleries:  []*GalleryReport{},
+	}
+	for _, r := range results {
+		g := &GalleryReport{
+			Name:       r.Name,
+			Warnings:   []string{},
+			Errors:     []*ReportError{},
+			DurationMs: int64(r.Duration / time.Millisecond),
+		}
+		switch {
+		case r.Err != nil:
+			report.Failed += 1
+			g.Status = REPORT_FAILED
+			g.Errors = reportErrors(r.Err)
+		case r.Diff.Skipped:
+			report.Skipped += 1
+			g.Status = REPORT_SKIPPED
+		default:
+			report.Imported += 1
+			g.Status = REPORT_IMPORTED
+		}
+		if d := r.Diff; d != nil {
+			g.GalleryId = d.GalleryId
+			g.Created = len(d.Created)
+			g.Updated = len(d.Changed)
+			g.Unchanged = d.Unchanged
+			if im.Prune {
+				g.Deleted = len(d.Removed)
+			}
+			if d.Warnings != nil {
+				g.Warnings = d.Warnings
+			}
+			g.Checksums = d.Checksums
+		}
+		report.Galleries = append(report.Galleries, g)
+	}
+	return report
+}
+
+// WriteJSON writes the report as indented JSON.
+func (report *Report) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
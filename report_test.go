@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewReport(t *testing.T) {
+	results := []*ImportResult{
+		{Name: "a.json", Duration: 1500 * time.Millisecond,
+			Diff: &GalleryDiff{GalleryId: "a",
+				Created:   []Exhibition{{Id: "1"}},
+				Changed:   []*ExhibitionChange{{Id: "2"}},
+				Removed:   []Exhibition{{Id: "3"}, {Id: "4"}},
+				Unchanged: 5,
+				Warnings:  []string{`Unknown attribute "adress"`},
+				Checksums: map[string]string{"": "abc", "2014.csv": "def"}}},
+		{Name: "b.json", Diff: &GalleryDiff{GalleryId: "b", Skipped: true}},
+		{Name: "c.json", Err: ParseErrors{}.Append("2014.csv", 3, 2,
+			"title should not be empty")},
+		{Name: "d.json", Err: ValidationError{"Invalid id: 1 should be UUID"}},
+		{Name: "e.json", Err: errors.New("GET e.json: 404 Not Found")},
+	}
+	report := NewReport(&Importer{Prune: true}, results, time.Now())
+	if report.Total != 5 || report.Imported != 1 || report.Skipped != 1 ||
+		report.Failed != 3 {
+		t.Fatalf("Unexpected counts: %v", report)
+	}
+
+	a := report.Galleries[0]
+	if a.Status != REPORT_IMPORTED || a.Created != 1 || a.Updated != 1 ||
+		a.Deleted != 2 || a.Unchanged != 5 || a.DurationMs != 1500 {
+		t.Fatalf("Unexpected report: %v", a)
+	}
+	if len(a.Warnings) != 1 || a.Checksums["2014.csv"] != "def" {
+		t.Fatalf("It should have warnings and checksums: %v", a)
+	}
+	if report.Galleries[1].Status != REPORT_SKIPPED {
+		t.Fatalf("Unexpected report: %v", report.Galleries[1])
+	}
+	expected := [][]*ReportError{
+		{{"2014.csv", 3, 2, "title should not be empty"}},
+		{{Message: "Invalid id: 1 should be UUID"}},
+		{{Message: "GET e.json: 404 Not Found"}},
+	}
+	for i, errs := range expected {
+		g := report.Galleries[i+2]
+		if g.Status != REPORT_FAILED || !reflect.DeepEqual(errs, g.Errors) {
+			t.Fatalf("Unexpected report: %v", g)
+		}
+	}
+
+	// deleted only with pruning
+	report = NewReport(&Importer{}, results[:1], time.Now())
+	if report.Galleries[0].Deleted != 0 {
+		t.Fatal("It should not count deleted exhibitions without pruning")
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	galleries := decoded["galleries"].([]interface{})
+	if galleries[0].(map[string]interface{})["errors"] == nil {
+		t.Fatal("errors should be an empty array rather than null")
+	}
+}
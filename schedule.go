@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// galleryTimeZone is the time zone of opening hours of galleries.
+var galleryTimeZone = time.FixedZone("JST", 9*60*60)
+
+// Closure is an irregular closure of a gallery such as a new year holiday.
+type Closure struct {
+	// DateRange is inclusive. The end is the same as the start for a single
+	// day.
+	DateRange dateRange
+	Note      string
+}
+
+type closureJSON struct {
+	Start string `json:"start"`
+	End   string `json:"end,omitempty"`
+	Note  string `json:"note,omitempty"`
+}
+
+// MarshalJSON encodes the closure as an object of start, end and note.
+func (c Closure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&closureJSON{
+		Start: c.DateRange[0].Format(DATE_LAYOUT),
+		End:   c.DateRange[1].Format(DATE_LAYOUT),
+		Note:  c.Note,
+	})
+}
+
+// UnmarshalJSON accepts a date of a single day or an object of start, end
+// and note. Dates are in the same formats as exhibition files. The end can
+// be omitted for a single day.
+//
+//	"2014-05-05"
+//	{"start": "2014/12/29", "end": "2015/01/03", "note": "年末年始"}
+func (c *Closure) UnmarshalJSON(b []byte) error {
+	var v closureJSON
+	if len(b) != 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &v.Start); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	start, err := parseDate(v.Start)
+	if err != nil {
+		return fmt.Errorf("Invalid closures: %s", err.Error())
+	}
+	end := start
+	if v.End != "" {
+		if end, err = parseDate(v.End); err != nil {
+			return fmt.Errorf("Invalid closures: %s", err.Error())
+		}
+	}
+	if end.Before(start) {
+		return fmt.Errorf("Invalid closures: end %s is before start %s",
+			v.End, v.Start)
+	}
+	*c = Closure{dateRange{start, end}, v.Note}
+	return nil
+}
+
+// Contains reports whether the closure has the date.
+func (c *Closure) Contains(date time.Time) bool {
+	d := date.Format(DATE_LAYOUT)
+	return c.DateRange[0].Format(DATE_LAYOUT) <= d &&
+		d <= c.DateRange[1].Format(DATE_LAYOUT)
+}
+
+func (c Closure) String() string {
+	if c.Note == "" {
+		return c.DateRange.Format()
+	}
+	return c.DateRange.Format() + " " + c.Note
+}
+
+// equalClosures reports whether closures have the same dates and notes.
+func equalClosures(a, b []Closure) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].DateRange.Equal(b[i].DateRange) || a[i].Note != b[i].Note {
+			return false
+		}
+	}
+	return true
+}
+
+// IsOpenOn reports whether the gallery is open on the date. It is closed on
+// weekly closing days and irregular closures.
+func (g *Gallery) IsOpenOn(date time.Time) bool {
+	if g.Hours.ClosedOn.Has(date.Weekday()) {
+		return false
+	}
+	for i := range g.Closures {
+		if g.Closures[i].Contains(date) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsOpenAt reports whether the gallery is open at t in the local time of the
+// gallery. Unknown opening or closing time is treated as open.
+func (g *Gallery) IsOpenAt(t time.Time) bool {
+	if !g.IsOpenOn(t) {
+		return false
+	}
+	clock := t.Format(CLOCK_LAYOUT)
+	return (g.Hours.OpenAt == "" || g.Hours.OpenAt <= clock) &&
+		(g.Hours.CloseAt == "" || clock < g.Hours.CloseAt)
+}
+
+// openOnSQL returns an SQL condition that the gallery g is open on the date
+// of the placeholder. It is the same as IsOpenOn.
+func openOnSQL(date string) string {
+	return fmt.Sprintf(`(g.closed_on & (1 << extract(dow FROM %s::date)::int) = 0
+		AND NOT EXISTS (
+			SELECT 1 FROM gallery_closure AS c
+			WHERE c.gallery_id = g.id AND c.date_range @> %s::date))`,
+		date, date)
+}
+
+// openAtSQL returns an SQL condition that the gallery g is open on the date
+// and at the time of the placeholders. It is the same as IsOpenAt.
+func openAtSQL(date, clock string) string {
+	return fmt.Sprintf(`(%s
+		AND (g.open_at IS NULL OR g.open_at <= %s::time)
+		AND (g.close_at IS NULL OR %s::time < g.close_at))`,
+		openOnSQL(date), clock, clock)
+}
+
+// openOnFilterSQL returns an SQL condition that the exhibition e is held on
+// the date of the placeholder and the gallery g is open on the date. It is
+// true if the placeholder is NULL.
+func openOnFilterSQL(date string) string {
+	return fmt.Sprintf(`(%s::date IS NULL OR (e.date_range @> %s::date AND %s))`,
+		date, date, openOnSQL(date))
+}
+
+// openOnParam returns the date of t for openOnFilterSQL. It is nil if t is
+// zero.
+func openOnParam(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(DATE_LAYOUT)
+}
+
+// listClosuresWith returns closures of a gallery with q. It returns nil if
+// there is no closure.
+func listClosuresWith(q Querier, galleryId string) ([]Closure, error) {
+	rows, err := q.Query(`
+		SELECT
+			lower(date_range), upper(date_range), note
+		FROM
+			gallery_closure
+		WHERE
+			gallery_id = $1
+		ORDER BY
+			lower(date_range)
+	`, galleryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var closures []Closure
+	for rows.Next() {
+		var start time.Time
+		var end *time.Time
+		var c Closure
+		if err := rows.Scan(&start, &end, &c.Note); err != nil {
+			return nil, err
+		}
+		c.DateRange = scanDateRange(start, end)
+		closures = append(closures, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return closures, nil
+}
+
+// saveClosuresWith replaces closures of a gallery with q.
+func saveClosuresWith(q Querier, g *Gallery) error {
+	_, err := q.Exec(`
+		DELETE FROM
+			gallery_closure
+		WHERE
+			gallery_id = $1
+	`, g.Id)
+	if err != nil {
+		return err
+	}
+	for _, c := range g.Closures {
+		_, err = q.Exec(`
+			INSERT INTO
+				gallery_closure (gallery_id, date_range, note)
+			VALUES
+				($1, $2, $3)
+		`, g.Id, c.DateRange.Format(), c.Note)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenGalleries returns galleries that are open at t in the local time of
+// galleries. Opening hours are ignored unless withHours.
+func OpenGalleries(t time.Time, withHours bool) ([]*Gallery, error) {
+	cond, args := openOnSQL("$1"), []interface{}{t.Format(DATE_LAYOUT)}
+	if withHours {
+		cond = openAtSQL("$1", "$2")
+		args = append(args, t.Format(CLOCK_LAYOUT))
+	}
+	rows, err := db.Query(`
+		SELECT`+galleryColumns+`
+		FROM
+			gallery AS g
+		WHERE
+			`+cond+`
+		ORDER BY
+			g.name, g.id
+		LIMIT
+			100
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []*Gallery{}
+	for rows.Next() {
+		g, err := scanGallery(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
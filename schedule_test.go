@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestClosureMarshaling(t *testing.T) {
+	var closures []Closure
+	err := json.Unmarshal([]byte(`[
+		"2014/05/05",
+		{"start": "2014/12/29", "end": "2015/01/03", "note": "年末年始"}
+	]`), &closures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closures) != 2 {
+		t.Fatalf("Unexpected closures: %v", closures)
+	}
+	if s := closures[0].DateRange.Format(); s != "[2014-05-05,2014-05-05]" {
+		t.Fatalf("A single day closure should end on the start: %s", s)
+	}
+	b, err := json.Marshal(closures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"start":"2014-05-05","end":"2014-05-05"},` +
+		`{"start":"2014-12-29","end":"2015-01-03","note":"年末年始"}]`
+	if string(b) != expected {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+
+	for _, s := range []string{
+		`"2014/13/05"`,
+		`{"end": "2014/05/05"}`,
+		`{"start": "2014/05/05", "end": "2014/05/04"}`,
+	} {
+		var c Closure
+		if err := json.Unmarshal([]byte(s), &c); err == nil {
+			t.Fatalf("%s should be an error", s)
+		}
+	}
+}
+
+func TestParseGalleryDataClosures(t *testing.T) {
+	g, _, err := ParseGalleryData([]byte(`{
+		"id": "B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		"closed_on": "月曜",
+		"closures": [{"start": "2014/12/29", "end": "2015/01/03"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := &Gallery{Id: g.Id, Hours: g.Hours}
+	d := DiffGallery(old, g, nil, nil)
+	if len(d.Gallery) != 1 || d.Gallery[0].Field != "closures" {
+		t.Fatalf("Closures should be changed: %v", d.Gallery)
+	}
+	if s := d.Gallery[0].String(); s != "closures: [] -> [[2014-12-29,2015-01-03]]" {
+		t.Fatalf("Unexpected change: %s", s)
+	}
+}
+
+func TestGalleryIsOpen(t *testing.T) {
+	g := &Gallery{Hours: OpeningHours{"10:00", "18:00", 1 << uint(time.Monday)}}
+	g.Closures = []Closure{{dateRange{
+		time.Date(2014, 12, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(2015, 1, 3, 0, 0, 0, 0, time.UTC)}, "年末年始"}}
+	for s, open := range map[string]bool{
+		"2014-05-10T15:00": true,
+		"2014-05-10T10:00": true,
+		"2014-05-10T09:59": false,
+		"2014-05-10T18:00": false,
+		"2014-05-12T15:00": false,
+		"2014-12-29T15:00": false,
+		"2015-01-03T15:00": false,
+		"2015-01-04T15:00": true,
+	} {
+		at, err := time.ParseInLocation("2006-01-02T15:04", s, galleryTimeZone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.IsOpenAt(at) != open {
+			t.Fatalf("IsOpenAt(%s) should be %v", s, open)
+		}
+	}
+	g.Hours.OpenAt, g.Hours.CloseAt = "", ""
+	at := time.Date(2014, 5, 10, 23, 0, 0, 0, galleryTimeZone)
+	if !g.IsOpenAt(at) {
+		t.Fatal("A gallery without opening hours should be open all day")
+	}
+}
+
+func TestQueryOpenAt(t *testing.T) {
+	now := time.Date(2014, 5, 10, 6, 0, 0, 0, time.UTC)
+	at, withHours, err := queryOpenAt(url.Values{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !withHours || at.Format("2006-01-02T15:04") != "2014-05-10T15:00" {
+		t.Fatalf("It should be now in the time zone of galleries: %v", at)
+	}
+	at, withHours, err = queryOpenAt(url.Values{"at": {"2014-05-12"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withHours || at.Weekday() != time.Monday {
+		t.Fatalf("A date should ignore opening hours: %v", at)
+	}
+	for _, s := range []string{"2014-05-10T15:00:30", "2014-05-10T15:00"} {
+		if _, withHours, err = queryOpenAt(url.Values{"at": {s}}, now); err != nil || !withHours {
+			t.Fatalf("%s should be valid: %v", s, err)
+		}
+	}
+	_, _, err = queryOpenAt(url.Values{"at": {"tomorrow"}}, now)
+	if vError, ok := err.(ValidationError); !ok || len(vError) != 1 {
+		t.Fatalf("tomorrow should be invalid: %v", err)
+	}
+}
+
+func TestOpenRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+
+	// Both galleries are closed on Mondays.
+	open := createRandomGallery()
+	closed := createRandomGallery()
+	closed.Closures = []Closure{{dateRange{
+		time.Date(2014, 5, 9, 0, 0, 0, 0, time.UTC),
+		time.Date(2014, 5, 11, 0, 0, 0, 0, time.UTC)}, "展示替え"}}
+	for _, g := range []*Gallery{open, closed} {
+		if err := g.Create(); err != nil {
+			t.Fatal(err)
+		}
+		e := &Exhibition{Id: "2014-5", GalleryId: g.Id, Title: "新緑展",
+			DateRange: *MustParseDateRange("2014-05-01", "2014-05-31")}
+		if err := e.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := GetGallery(closed.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalClosures(stored.Closures, closed.Closures) {
+		t.Fatalf("Closures should be stored: %v", stored.Closures)
+	}
+
+	at := time.Date(2014, 5, 10, 15, 0, 0, 0, galleryTimeZone)
+	galleries, err := OpenGalleries(at, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(galleries) != 1 || galleries[0].Id != open.Id {
+		t.Fatalf("Only the open gallery should be found: %v", galleries)
+	}
+	if galleries, err = OpenGalleries(at.Add(4*time.Hour), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(galleries) != 0 {
+		t.Fatalf("Galleries should be closed after 18:00: %v", galleries)
+	}
+	if galleries, err = OpenGalleries(at.Add(4*time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(galleries) != 1 {
+		t.Fatalf("Opening hours should be ignored: %v", galleries)
+	}
+	if galleries, err = OpenGalleries(at.AddDate(0, 0, 2), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(galleries) != 0 {
+		t.Fatalf("Galleries should be closed on Mondays: %v", galleries)
+	}
+
+	dr := &dateRange{at, at}
+	exhibitions, err := SearchExhibitions(dr, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 1 || exhibitions[0].Gallery.Id != open.Id {
+		t.Fatalf("Only the exhibition of the open gallery should be found: %v",
+			exhibitions)
+	}
+	if exhibitions, err = SearchExhibitions(dr, at.AddDate(0, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(exhibitions) != 0 {
+		t.Fatalf("No exhibition should be found on Monday: %v", exhibitions)
+	}
+
+	rt := &routeTest{"/galleries/open?%s", []routeCase{
+		{[]string{""}, 200, nil},
+		{[]string{"at=2014-05-10T15:00"}, 200, nil},
+		{[]string{"at=2014-05-10"}, 200, nil},
+		{[]string{"at=2014-05-10T25:00"}, 400, nil},
+	}}
+	rt.exec(t)
+	rt = &routeTest{"/exhibitions/2014-05-10?%s", []routeCase{
+		{[]string{"open_on=2014-05-10"}, 200, nil},
+		{[]string{"open_on=2014-05-10&near=43.7627,142.3582"}, 200, nil},
+		{[]string{"open_on=saturday"}, 400, nil},
+	}}
+	rt.exec(t)
+}
@@ -11,6 +11,9 @@ import (
 
 var (
 	Status500 = []byte(`{"message": "InternalServerError"}`)
+	// uploadImporter imports uploaded galleries. It is the importer that is
+	// configured by command line flags.
+	uploadImporter = &Importer{Prune: true, PruneLimit: 50}
 )
 
 func New404(urlStr string) *NotFoundError {
@@ -25,10 +28,19 @@ func (err *NotFoundError) Error() string {
 	return "URL " + err.url + "NotFound"
 }
 
+// UnauthorizedError is an error of a request without a valid token.
+type UnauthorizedError struct{}
+
+func (err *UnauthorizedError) Error() string {
+	return "Unauthorized"
+}
+
 type ListResponse struct {
 	Results interface{} `json:"results,omitempty"`
-	Errors  interface{} `json:"errors,omitempty"`
-	Code    int         `json:"code,omitempty"`
+	// Total is the number of results of every page.
+	Total  int         `json:"total,omitempty"`
+	Errors interface{} `json:"errors,omitempty"`
+	Code   int         `json:"code,omitempty"`
 }
 
 // HandleError
@@ -37,6 +49,8 @@ func HandleError(w http.ResponseWriter, r *http.Request, err error) {
 		BadRequest(w, v)
 	} else if _, ok := err.(*NotFoundError); ok {
 		NotFound(w)
+	} else if _, ok := err.(*UnauthorizedError); ok {
+		Unauthorized(w)
 	} else {
 		InternalServerError(w)
 		log.Println("Internal Server Error: " + err.Error())
@@ -61,6 +75,12 @@ func NotFound(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
+// Unauthorized sends 401 unauthorized status that asks a bearer token.
+func Unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
 func Boot(w http.ResponseWriter, r *http.Request) error {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -68,6 +88,11 @@ func Boot(w http.ResponseWriter, r *http.Request) error {
 }
 
 func Json(w http.ResponseWriter, model interface{}) {
+	JsonStatus(w, http.StatusOK, model)
+}
+
+// JsonStatus sends model as JSON with the status code.
+func JsonStatus(w http.ResponseWriter, code int, model interface{}) {
 	b, err := json.Marshal(model)
 	if err != nil {
 		log.Println("JSON Marshaling Error: " + err.Error())
@@ -75,9 +100,16 @@ func Json(w http.ResponseWriter, model interface{}) {
 		return
 	}
 	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(code)
 	w.Write(b)
 }
 
+// JsonBadRequest sends errors as JSON with 400 status.
+func JsonBadRequest(w http.ResponseWriter, err error) {
+	JsonStatus(w, http.StatusBadRequest, &ListResponse{
+		Errors: reportErrors(err), Code: http.StatusBadRequest})
+}
+
 // App returns main http multiplexer.
 func App() *patree.PatternTreeServeMux {
 	mux := patree.New()
@@ -87,10 +119,34 @@ func App() *patree.PatternTreeServeMux {
 	exHandler := &ExhibitionHandler{"exhibition_id", "gallery_id", "date"}
 	mux.Get("/galleries/<uuid:gallery_id>/exhibitions/<exhibition_id>",
 		exHandler.Get)
+	mux.Post("/galleries/<uuid:gallery_id>/exhibitions/<exhibition_id>",
+		exHandler.Post)
+	mux.Put("/galleries/<uuid:gallery_id>/exhibitions/<exhibition_id>",
+		exHandler.Put)
+	mux.Handle("PATCH", "/galleries/<uuid:gallery_id>/exhibitions/<exhibition_id>",
+		exHandler.Patch)
+	mux.Delete("/galleries/<uuid:gallery_id>/exhibitions/<exhibition_id>",
+		exHandler.Delete)
 	mux.Get("/galleries/<uuid:gallery_id>/exhibitions", exHandler.ListByGallery)
 	mux.Get("/exhibitions/<date:date>", exHandler.FindByDate)
 
 	gHandler := &GalleryHandler{"gallery_id"}
+	mux.Get("/galleries", gHandler.List)
+	mux.Get("/galleries/near", gHandler.Near)
+	mux.Get("/galleries/open", gHandler.Open)
 	mux.Get("/galleries/<uuid:gallery_id>", gHandler.Get)
+	mux.Post("/galleries/<uuid:gallery_id>", gHandler.Post)
+	mux.Put("/galleries/<uuid:gallery_id>", gHandler.Put)
+	mux.Handle("PATCH", "/galleries/<uuid:gallery_id>", gHandler.Patch)
+	mux.Delete("/galleries/<uuid:gallery_id>", gHandler.Delete)
+	mux.Get("/galleries/<uuid:gallery_id>/checksums", gHandler.Checksums)
+	mux.Get("/galleries/<uuid:gallery_id>/source", gHandler.Source)
+
+	uHandler := &UploadHandler{"gallery_id", uploadImporter, 10 << 20}
+	mux.Post("/galleries/<uuid:gallery_id>/import", uHandler.Import)
+
+	whHandler := &WebhookHandler{"gallery_id", webhookJobs, 1 << 20}
+	mux.Post("/galleries/<uuid:gallery_id>/webhook", whHandler.Post)
+	mux.Get("/galleries/<uuid:gallery_id>/jobs", whHandler.Jobs)
 	return mux
 }
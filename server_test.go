@@ -8,9 +8,11 @@ import (
 	"github.com/satori/go.uuid"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type routeTest struct {
@@ -187,3 +189,126 @@ func TestGalleryRoutes(t *testing.T) {
 	}}
 	rt.exec(t)
 }
+
+func TestGalleryChecksumRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	if err := ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	rt := &routeTest{"/galleries/%s/checksums", []routeCase{
+		{[]string{"B9FE1506-30C4-4CFF-B73E-99D859199A6D"}, 200, nil},
+		{[]string{uuid.NewV4().String()}, 404, nil},
+	}}
+	rt.exec(t)
+}
+
+func TestGallerySourceRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	if err := ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	if err := RegisterSource(galleryId, "http://example.com/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	rt := &routeTest{"/galleries/%s/source", []routeCase{
+		{[]string{galleryId}, 200, nil},
+		{[]string{uuid.NewV4().String()}, 404, nil},
+	}}
+	rt.exec(t)
+}
+
+func TestParseGalleryQuery(t *testing.T) {
+	v := url.Values{}
+	q, err := parseGalleryQuery(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Offset != 0 || q.Limit != 20 || q.Sort != "" {
+		t.Fatalf("Unexpected default query: %v", q)
+	}
+	v.Set("offset", "20")
+	v.Set("limit", "10")
+	v.Set("sort", "-updated")
+	v.Set("prefecture", "北海道")
+	if q, err = parseGalleryQuery(v); err != nil {
+		t.Fatal(err)
+	}
+	if q.Offset != 20 || q.Limit != 10 || q.Sort != "-updated" ||
+		q.Prefecture != "北海道" {
+		t.Fatalf("Unexpected query: %v", q)
+	}
+
+	v = url.Values{"offset": {"a"}, "limit": {"1000"}}
+	if _, err = parseGalleryQuery(v); len(err) != 1 {
+		t.Fatalf("offset should be invalid: %v", err)
+	}
+	v = url.Values{"limit": {"1000"}, "sort": {"city"}}
+	if _, err = parseGalleryQuery(v); len(err) != 2 {
+		t.Fatalf("limit and sort should be invalid: %v", err)
+	}
+}
+
+func TestGalleryListRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	if _, err := insertRandomGallery(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	galleries, total, err := ListGalleries(&GalleryQuery{Limit: 2,
+		Sort: "name", Date: time.Date(2014, 1, 15, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 6 || len(galleries) != 2 {
+		t.Fatalf("Expected 2 of 6 galleries. But got %d of %d", len(galleries),
+			total)
+	}
+	if galleries[0].Name > galleries[1].Name {
+		t.Fatalf("Galleries should be sorted by name: %v", galleries)
+	}
+
+	_, total, err = ListGalleries(&GalleryQuery{Limit: 10,
+		Prefecture: "北海道"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 {
+		t.Fatalf("Only random galleries are in 北海道: %d", total)
+	}
+
+	galleries, _, err = ListGalleries(&GalleryQuery{Limit: 10,
+		Sort: "-updated", Date: time.Date(2014, 1, 15, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range galleries {
+		if g.Name == "ヒラマ画廊" && (g.Current != 1 || g.Upcoming != 28) {
+			t.Fatalf("Unexpected summary of ヒラマ画廊: %v", g)
+		}
+	}
+
+	rt := &routeTest{"/galleries%s", []routeCase{
+		{[]string{""}, 200, nil},
+		{[]string{"?offset=2&limit=2&sort=-updated"}, 200, nil},
+		{[]string{"?prefecture=%E5%8C%97%E6%B5%B7%E9%81%93"}, 200, nil},
+		{[]string{"?limit=0"}, 400, nil},
+		{[]string{"?sort=city"}, 400, nil},
+	}}
+	rt.exec(t)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Statuses of a gallery source.
+const (
+	SOURCE_PENDING   = "pending"
+	SOURCE_IMPORTED  = "imported"
+	SOURCE_UNCHANGED = "unchanged"
+	SOURCE_FAILED    = "failed"
+)
+
+// validator is a cache validator of a fetched URL.
+type validator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Source is a remote gallery JSON that is crawled periodically.
+type Source struct {
+	GalleryId string `json:"gallery_id"`
+	URL       string `json:"url"`
+	// Interval is seconds between crawls. Zero means the default interval.
+	Interval int `json:"interval"`
+	// Validators maps the gallery JSON URL and exhibition file URLs to their
+	// validators of the last fetch.
+	Validators map[string]*validator `json:"-"`
+	Status     string                `json:"status"`
+	// HTTPCode is the status code of the last response. Zero if no response
+	// is received.
+	HTTPCode  int       `json:"http_code"`
+	LastError string    `json:"last_error"`
+	Checked   time.Time `json:"checked"`
+}
+
+func scanSource(row interface {
+	Scan(dest ...interface{}) error
+}) (*Source, error) {
+	s := &Source{}
+	var validators []byte
+	err := row.Scan(&s.GalleryId, &s.URL, &s.Interval, &validators, &s.Status,
+		&s.HTTPCode, &s.LastError, &s.Checked)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(validators, &s.Validators); err != nil {
+		return nil, err
+	}
+	if s.Validators == nil {
+		s.Validators = make(map[string]*validator)
+	}
+	return s, nil
+}
+
+// GetSource returns the source of a gallery. nil if it is not registered.
+func GetSource(galleryId string) (*Source, error) {
+	row := db.QueryRow(`
+		SELECT
+			gallery_id, url, interval_seconds, validators, status, http_code,
+			last_error, checked
+		FROM
+			gallery_source
+		WHERE
+			gallery_id = $1
+	`, galleryId)
+	s, err := scanSource(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+// ListDueSources returns sources that are not checked for their interval at
+// now. defaultInterval is used for sources without their own interval.
+func ListDueSources(now time.Time, defaultInterval time.Duration) ([]*Source, error) {
+	rows, err := db.Query(`
+		SELECT
+			gallery_id, url, interval_seconds, validators, status, http_code,
+			last_error, checked
+		FROM
+			gallery_source
+		WHERE
+			checked + (CASE WHEN interval_seconds > 0 THEN interval_seconds
+				ELSE $1 END) * interval '1 second' <= $2
+		ORDER BY
+			checked, gallery_id
+	`, int(defaultInterval/time.Second), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []*Source{}
+	for rows.Next() {
+		s, err := scanSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// RegisterSource registers the URL of a gallery to crawl. Validators are
+// cleared if the URL is changed.
+func RegisterSource(galleryId, url string) error {
+	return RegisterSourceWith(db, galleryId, url)
+}
+
+// RegisterSourceWith registers the URL of a gallery to crawl with q.
+func RegisterSourceWith(q Querier, galleryId, url string) error {
+	result, err := q.Exec(`
+		UPDATE
+			gallery_source
+		SET
+			(url, validators) = ($2,
+				CASE WHEN url = $2 THEN validators ELSE '{}'::json END)
+		WHERE
+			gallery_id = $1
+	`, galleryId, url)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 0 {
+		return err
+	}
+	_, err = q.Exec(`
+		INSERT INTO
+			gallery_source (gallery_id, url)
+		VALUES
+			($1, $2)
+	`, galleryId, url)
+	return err
+}
+
+// IssueWebhookSecret makes a new secret of the webhook of a registered source
+// to sign requests. A former secret is no longer valid.
+func IssueWebhookSecret(galleryId string) (string, error) {
+	secret, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	result, err := db.Exec(`
+		UPDATE
+			gallery_source
+		SET
+			webhook_secret = $2
+		WHERE
+			gallery_id = $1
+	`, galleryId, secret)
+	if err != nil {
+		return "", err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return "", err
+	} else if n == 0 {
+		return "", ValidationError{fmt.Sprintf(
+			"No source is registered for gallery %s", galleryId)}
+	}
+	return secret, nil
+}
+
+// GetWebhookSecret returns the webhook secret of a source. It is empty if the
+// source is not registered or has no secret.
+func GetWebhookSecret(galleryId string) (string, error) {
+	var secret string
+	err := db.QueryRow(`
+		SELECT
+			webhook_secret
+		FROM
+			gallery_source
+		WHERE
+			gallery_id = $1
+	`, galleryId).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return secret, err
+}
+
+// SaveStatus stores the result of the last crawl.
+func (s *Source) SaveStatus() error {
+	validators, err := json.Marshal(s.Validators)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE
+			gallery_source
+		SET
+			(validators, status, http_code, last_error, checked) =
+			($2, $3, $4, $5, $6)
+		WHERE
+			gallery_id = $1
+	`, s.GalleryId, string(validators), s.Status, s.HTTPCode, s.LastError,
+		s.Checked)
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tokenHash returns a hex encoded SHA-256 hash of a token. Only hashes of
+// tokens are stored.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns a random hex encoded token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IssueToken makes a new token of a gallery to upload its data. A former
+// token of the gallery is no longer valid. The gallery doesn't have to be
+// imported yet.
+func IssueToken(galleryId string) (string, error) {
+	if !IsUUID(galleryId) {
+		return "", ValidationError{
+			fmt.Sprintf("Invalid Id: %s is not an UUID", galleryId)}
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	err = withTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE
+				gallery_token
+			SET
+				(token_hash, created) = ($2, now())
+			WHERE
+				gallery_id = $1
+		`, galleryId, tokenHash(token))
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n != 0 {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO
+				gallery_token (gallery_id, token_hash)
+			VALUES
+				($1, $2)
+		`, galleryId, tokenHash(token))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyToken reports whether token is the token of a gallery.
+func VerifyToken(galleryId, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	var hash string
+	err := db.QueryRow(`
+		SELECT
+			token_hash
+		FROM
+			gallery_token
+		WHERE
+			gallery_id = $1
+	`, galleryId).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(hash),
+		[]byte(tokenHash(token))) == 1, nil
+}
+
+// bearerToken returns the token of the Authorization header of r. It is empty
+// unless the header is a bearer token.
+func bearerToken(r *http.Request) string {
+	s := r.Header.Get("Authorization")
+	if len(s) < 7 || !strings.EqualFold(s[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(s[7:])
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/smagch/patree"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+// UploadHandler imports gallery data uploaded by its publisher. A request is
+// a multipart form that has the gallery JSON as "gallery" and exhibition
+// files as "files". File names of exhibition files should be the same as in
+// the gallery JSON. The request must have the token of the gallery as a
+// bearer token.
+type UploadHandler struct {
+	IdName   string
+	Importer *Importer
+	// MaxBytes is the maximum size of a request body.
+	MaxBytes int64
+}
+
+// readPart reads an uploaded file.
+func readPart(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// readUpload reads uploaded files. It returns the name of the gallery JSON
+// and a loader of the files.
+func readUpload(form *multipart.Form) (name string, l mapLoader, err error) {
+	galleries := form.File["gallery"]
+	if len(galleries) != 1 {
+		return "", nil, ValidationError{"gallery should be a gallery JSON file"}
+	}
+	l = mapLoader{}
+	for _, fh := range append(form.File["files"], galleries[0]) {
+		if l[fh.Filename], err = readPart(fh); err != nil {
+			return "", nil, err
+		}
+	}
+	return galleries[0].Filename, l, nil
+}
+
+// Import imports uploaded gallery data in the same way as importing files.
+// It sends the import report, or errors with 400 status if the data is
+// invalid. It sends 409 status if the import exceeds the prune limit.
+func (h *UploadHandler) Import(w http.ResponseWriter, r *http.Request) error {
+	id := patree.Param(r, h.IdName)
+	ok, err := VerifyToken(id, bearerToken(r))
+	if err != nil {
+		return err
+	} else if !ok {
+		return &UnauthorizedError{}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxBytes)
+	if err = r.ParseMultipartForm(h.MaxBytes); err != nil {
+		JsonBadRequest(w, err)
+		return nil
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	started := time.Now()
+	result := &ImportResult{}
+	result.Name, result.Diff, result.Err = h.importUpload(id, r.MultipartForm)
+	result.Duration = time.Since(started)
+	switch result.Err.(type) {
+	case nil:
+	case ValidationError, ParseErrors:
+		JsonBadRequest(w, result.Err)
+		return nil
+	case *PruneLimitError:
+		JsonStatus(w, http.StatusConflict, &ListResponse{
+			Errors: reportErrors(result.Err), Code: http.StatusConflict})
+		return nil
+	default:
+		return result.Err
+	}
+	Json(w, NewReport(h.Importer, []*ImportResult{result}, started))
+	return nil
+}
+
+// importUpload imports uploaded files of the gallery.
+func (h *UploadHandler) importUpload(id string, form *multipart.Form) (string, *GalleryDiff, error) {
+	name, l, err := readUpload(form)
+	if err != nil {
+		return "", nil, err
+	}
+	d, err := h.Importer.ImportFor(l, name, id)
+	return name, d, err
+}
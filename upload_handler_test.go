@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newUploadRequest makes a multipart request that uploads files. The first
+// file is the gallery JSON.
+func newUploadRequest(urlStr, token string, names []string, contents [][]byte) (*http.Request, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, name := range names {
+		field := "files"
+		if i == 0 {
+			field = "gallery"
+		}
+		fw, err := mw.CreateFormFile(field, name)
+		if err != nil {
+			return nil, err
+		}
+		fw.Write(contents[i])
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest("POST", urlStr, &body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r, nil
+}
+
+func TestBearerToken(t *testing.T) {
+	for header, expected := range map[string]string{
+		"Bearer abc":  "abc",
+		"bearer abc ": "abc",
+		"Basic abc":   "",
+		"Bearer":      "",
+		"":            "",
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", header)
+		if token := bearerToken(r); token != expected {
+			t.Fatalf("%q: Expected %q. But got %q instead", header, expected,
+				token)
+		}
+	}
+}
+
+func TestReadUpload(t *testing.T) {
+	r, err := newUploadRequest("/", "", []string{"hirama.json", "2014.csv"},
+		[][]byte{[]byte(`{}`), []byte(hiramaCSV)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	name, l, err := readUpload(r.MultipartForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "hirama.json" || string(l["2014.csv"]) != hiramaCSV {
+		t.Fatalf("Unexpected upload: %s %v", name, l)
+	}
+
+	delete(r.MultipartForm.File, "gallery")
+	if _, _, err = readUpload(r.MultipartForm); err == nil {
+		t.Fatal("It should be an error without gallery")
+	}
+}
+
+func TestUploadImport(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	token, err := IssueToken(galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gallery, err := ioutil.ReadFile("fixtures/hirama/hirama.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv, err := ioutil.ReadFile("fixtures/hirama/2014.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"hirama.json", "2014.csv"}
+	invalidCSV := append(csv, []byte("\n2014-99,,2014/01/05,2014/01/13\n")...)
+
+	cases := []struct {
+		galleryId string
+		token     string
+		contents  [][]byte
+		code      int
+	}{
+		{galleryId, "", [][]byte{gallery, csv}, 401},
+		{galleryId, "invalid", [][]byte{gallery, csv}, 401},
+		{galleryId, token, [][]byte{gallery, invalidCSV}, 400},
+		{galleryId, token, [][]byte{gallery, []byte("")}, 400},
+		{galleryId, token, [][]byte{gallery, csv}, 200},
+	}
+	mux := App()
+	for _, c := range cases {
+		r, err := newUploadRequest("/galleries/"+c.galleryId+"/import",
+			c.token, names, c.contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Fatalf("Status code should be %d rather than %d: %s", c.code,
+				w.Code, w.Body.String())
+		}
+	}
+
+	otherId := "6ba7b814-9dad-11d1-80b4-00c04fd430c8"
+	otherToken, err := IssueToken(otherId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newUploadRequest("/galleries/"+otherId+"/import", otherToken,
+		names, [][]byte{gallery, csv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != 400 {
+		t.Fatalf("Gallery of another id should not be imported: %d", w.Code)
+	}
+	var res listResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res.Errors), "is not the gallery "+otherId) {
+		t.Fatalf("Unexpected errors: %s", res.Errors)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -51,3 +52,48 @@ func (err ValidationError) Append(msg string) ValidationError {
 func (err ValidationError) Error() string {
 	return "Validation Error:\n" + strings.Join(err, "\n")
 }
+
+// ParseError is an error found at a line and column of a data file. Line and
+// Column are 1-based, zero means unknown.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error returns a message prefixed with the position. e.g.
+// "2014.csv:3:2: title should not be empty"
+func (err *ParseError) Error() string {
+	var pos []string
+	if err.File != "" {
+		pos = append(pos, err.File)
+	}
+	if err.Line != 0 {
+		pos = append(pos, strconv.Itoa(err.Line))
+		if err.Column != 0 {
+			pos = append(pos, strconv.Itoa(err.Column))
+		}
+	}
+	if len(pos) == 0 {
+		return err.Message
+	}
+	return strings.Join(pos, ":") + ": " + err.Message
+}
+
+// ParseErrors is a ValidationError that keeps the position of each error.
+type ParseErrors []*ParseError
+
+// Append add an error at the given position.
+func (errs ParseErrors) Append(file string, line, column int, msg string) ParseErrors {
+	return append(errs, &ParseError{file, line, column, msg})
+}
+
+// Error returns a concatenated error message.
+func (errs ParseErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return ValidationError(msgs).Error()
+}
@@ -40,3 +40,17 @@ func TestValidationError(t *testing.T) {
 		}
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	var errs ParseErrors
+	errs = errs.Append("2014.csv", 1, 0, `column "end" is required`)
+	errs = errs.Append("2014.csv", 3, 2, "title should not be empty")
+	errs = errs.Append("", 0, 0, "no position")
+	expected := "Validation Error:\n" +
+		"2014.csv:1: column \"end\" is required\n" +
+		"2014.csv:3:2: title should not be empty\n" +
+		"no position"
+	if msg := errs.Error(); msg != expected {
+		t.Fatalf("Expected %q. But got %q instead", expected, msg)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// fileState is the state of a watched file.
+type fileState struct {
+	Exists  bool
+	Size    int64
+	ModTime time.Time
+}
+
+func statFile(name string) (fileState, error) {
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{true, fi.Size(), fi.ModTime()}, nil
+}
+
+// Watcher polls gallery JSON files and their exhibition files, and imports a
+// gallery when any of its files is changed. Changes are debounced, so a
+// gallery is imported once after its files stay unchanged for Delay.
+type Watcher struct {
+	// Targets are gallery JSON files or directories. New galleries in the
+	// directories are watched too. URLs are ignored.
+	Targets []string
+	// Interval is the interval of polling.
+	Interval time.Duration
+	// Delay is the time to wait after the last change of a gallery.
+	Delay time.Duration
+	// Import imports a gallery JSON file.
+	Import func(name string) (*GalleryDiff, error)
+	// Out is where results and errors are written.
+	Out io.Writer
+
+	// states are states of files of each gallery.
+	states map[string]map[string]fileState
+	// pending is the time of the last change of each changed gallery.
+	pending map[string]time.Time
+}
+
+// watchedFiles returns the gallery JSON file and its exhibition files. Only
+// the gallery JSON is watched if it is invalid.
+func watchedFiles(name string) []string {
+	files := []string{name}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return files
+	}
+	_, exhibitions, err := ParseGalleryData(b)
+	if err != nil {
+		return files
+	}
+	l := fileLoader{}
+	for _, f := range exhibitions {
+		if f.Name == "" {
+			continue
+		}
+		if file, err := l.Resolve(name, f.Name); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// snapshot returns the current states of files of a gallery.
+func snapshot(name string) (map[string]fileState, error) {
+	states := make(map[string]fileState)
+	for _, file := range watchedFiles(name) {
+		s, err := statFile(file)
+		if err != nil {
+			return nil, err
+		}
+		states[file] = s
+	}
+	return states, nil
+}
+
+func sameStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, s := range a {
+		if t, ok := b[name]; !ok || s.Exists != t.Exists || s.Size != t.Size ||
+			!s.ModTime.Equal(t.ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// poll checks files and returns galleries to import at now, sorted by name.
+// Galleries found at the first poll are not imported until they change.
+func (w *Watcher) poll(now time.Time) []string {
+	first := w.states == nil
+	if first {
+		w.states = make(map[string]map[string]fileState)
+		w.pending = make(map[string]time.Time)
+	}
+	names, err := FindGalleries(w.Targets)
+	if err != nil {
+		fmt.Fprintf(w.Out, "FAIL %s\n", err.Error())
+		return nil
+	}
+
+	found := make(map[string]bool)
+	for _, name := range names {
+		if isURL(name) {
+			continue
+		}
+		found[name] = true
+		w.check(name, now, first)
+	}
+	for name := range w.states {
+		if found[name] {
+			continue
+		}
+		// A gallery JSON that is no longer found but exists, such as with a
+		// syntax error, is still watched so that its import reports why.
+		if s, err := statFile(name); err == nil && s.Exists {
+			w.check(name, now, first)
+			continue
+		}
+		delete(w.states, name)
+		delete(w.pending, name)
+	}
+
+	ready := []string{}
+	for name, changed := range w.pending {
+		if now.Sub(changed) >= w.Delay {
+			ready = append(ready, name)
+			delete(w.pending, name)
+		}
+	}
+	sort.Strings(ready)
+	return ready
+}
+
+// check updates states of files of a gallery, and makes the gallery pending
+// at now if any of them is changed.
+func (w *Watcher) check(name string, now time.Time, first bool) {
+	states, err := snapshot(name)
+	if err != nil {
+		fmt.Fprintf(w.Out, "FAIL %s: %s\n", name, err.Error())
+		return
+	}
+	if old, ok := w.states[name]; (ok || !first) && !sameStates(old, states) {
+		w.pending[name] = now
+	}
+	w.states[name] = states
+}
+
+// Run polls files and imports changed galleries until stop is closed. A
+// failure is written to Out and doesn't stop watching.
+func (w *Watcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	w.poll(time.Now())
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for _, name := range w.poll(now) {
+				start := time.Now()
+				r := &ImportResult{Name: name}
+				r.Diff, r.Err = w.Import(name)
+				r.Duration = time.Since(start)
+				writeResult(w.Out, r)
+			}
+		}
+	}
+}
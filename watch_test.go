@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opengallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string, modTime time.Time) {
+		name = path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2014, 1, 5, 10, 0, 0, 0, time.UTC)
+	hirama := `{"id": "B9FE1506-30C4-4CFF-B73E-99D859199A6D", "name": "Hirama",
+		"exhibitions": ["2014.csv"]}`
+	write("hirama/hirama.json", hirama, base)
+	write("hirama/2014.csv", hiramaCSV, base)
+	write("ginza/ginza.json", `{"id": "a", "exhibitions": ["2014.csv"]}`, base)
+
+	w := &Watcher{Targets: []string{dir}, Delay: time.Second}
+	now := base
+	poll := func(d time.Duration) []string {
+		now = now.Add(d)
+		return w.poll(now)
+	}
+	if names := poll(0); len(names) != 0 {
+		t.Fatalf("It should not import at the first poll. But got %v", names)
+	}
+
+	// an exhibition file is changed twice in the delay
+	write("hirama/2014.csv", hiramaCSV+"\n", base.Add(time.Minute))
+	if names := poll(time.Millisecond * 500); len(names) != 0 {
+		t.Fatalf("It should wait for the delay. But got %v", names)
+	}
+	write("hirama/2014.csv", hiramaCSV+"\n\n", base.Add(2*time.Minute))
+	if names := poll(time.Millisecond * 500); len(names) != 0 {
+		t.Fatalf("It should wait for the delay. But got %v", names)
+	}
+	expected := []string{path.Join(dir, "hirama/hirama.json")}
+	if names := poll(time.Second); !reflect.DeepEqual(expected, names) {
+		t.Fatalf("Expected %v. But got %v instead", expected, names)
+	}
+	if names := poll(time.Second); len(names) != 0 {
+		t.Fatalf("It should import once. But got %v", names)
+	}
+
+	// a missing exhibition file is created, and a new gallery is added
+	write("ginza/2014.csv", hiramaCSV, base)
+	write("ueno/ueno.json", `{"id": "b", "exhibitions": []}`, base)
+	poll(time.Second)
+	expected = []string{
+		path.Join(dir, "ginza/ginza.json"),
+		path.Join(dir, "ueno/ueno.json"),
+	}
+	if names := poll(time.Second); !reflect.DeepEqual(expected, names) {
+		t.Fatalf("Expected %v. But got %v instead", expected, names)
+	}
+
+	// a gallery JSON with a syntax error is imported to report the error
+	write("ueno/ueno.json", `{"id": "b", "exhibitions": [}`, base.Add(time.Minute))
+	poll(time.Second)
+	expected = []string{path.Join(dir, "ueno/ueno.json")}
+	if names := poll(time.Second); !reflect.DeepEqual(expected, names) {
+		t.Fatalf("Expected %v. But got %v instead", expected, names)
+	}
+
+	// a removed gallery is not watched
+	if err := os.Remove(path.Join(dir, "ueno/ueno.json")); err != nil {
+		t.Fatal(err)
+	}
+	poll(time.Second)
+	if _, ok := w.states[path.Join(dir, "ueno/ueno.json")]; ok {
+		t.Fatal("A removed gallery should not be watched")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/smagch/patree"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// webhookJobs is the queue of re-imports requested by webhooks.
+var webhookJobs = NewJobQueue(100)
+
+// signatureHeader is the header of the signature of a webhook request. It is
+// "sha256=" followed by the hex encoded HMAC-SHA256 of the body.
+const signatureHeader = "X-Hub-Signature-256"
+
+// validSignature reports whether signature is the signature of body by
+// secret.
+func validSignature(secret string, body []byte, signature string) bool {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	sig, err := hex.DecodeString(signature[len("sha256="):])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// WebhookHandler queues re-imports of gallery sources requested by their
+// publishers.
+type WebhookHandler struct {
+	IdName string
+	Queue  *JobQueue
+	// MaxBytes is the maximum size of a request body.
+	MaxBytes int64
+}
+
+// Post queues a re-import of the registered source of a gallery. The request
+// must be signed by the webhook secret of the source. It sends the job with
+// 202 status. The job that is already queued is sent if any.
+func (h *WebhookHandler) Post(w http.ResponseWriter, r *http.Request) error {
+	id := strings.ToLower(patree.Param(r, h.IdName))
+	secret, err := GetWebhookSecret(id)
+	if err != nil {
+		return err
+	} else if secret == "" {
+		return New404(r.URL.Path)
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxBytes))
+	if err != nil {
+		JsonBadRequest(w, err)
+		return nil
+	}
+	if !validSignature(secret, body, r.Header.Get(signatureHeader)) {
+		return &UnauthorizedError{}
+	}
+	job, _ := h.Queue.Enqueue(id)
+	JsonStatus(w, http.StatusAccepted, job)
+	return nil
+}
+
+// Jobs sends queued, running and recently done jobs of a gallery. The request
+// needs the token of the gallery since jobs have raw import errors.
+func (h *WebhookHandler) Jobs(w http.ResponseWriter, r *http.Request) error {
+	id := strings.ToLower(patree.Param(r, h.IdName))
+	if err := authorize(r, id); err != nil {
+		return err
+	}
+	jobs := []Job{}
+	for _, job := range h.Queue.Jobs() {
+		if job.GalleryId == id {
+			jobs = append(jobs, job)
+		}
+	}
+	Json(w, &ListResponse{Results: jobs})
+	return nil
+}
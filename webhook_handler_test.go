@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/master"}`)
+	if !validSignature("secret", body, sign("secret", body)) {
+		t.Fatal("Signature should be valid")
+	}
+	for _, signature := range []string{
+		sign("other", body),
+		sign("secret", []byte(`{}`)),
+		"sha256=zz",
+		"",
+	} {
+		if validSignature("secret", body, signature) {
+			t.Fatalf("%s should be invalid", signature)
+		}
+	}
+	if validSignature("", body, sign("", body)) {
+		t.Fatal("Empty secret should not be valid")
+	}
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+	if err := ImportFixture("fixtures/hirama/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	galleryId := "b9fe1506-30c4-4cff-b73e-99d859199a6d"
+	if err := RegisterSource(galleryId, "http://example.com/hirama.json"); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := IssueWebhookSecret(galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IssueWebhookSecret(uuid.NewV4().String()); err == nil {
+		t.Fatal("Secret should not be issued without a source")
+	}
+
+	body := []byte(`{"ref": "refs/heads/master"}`)
+	cases := []struct {
+		galleryId string
+		signature string
+		code      int
+	}{
+		{galleryId, "", 401},
+		{galleryId, sign("invalid", body), 401},
+		{uuid.NewV4().String(), sign(secret, body), 404},
+		{galleryId, sign(secret, body), 202},
+		{galleryId, sign(secret, body), 202},
+	}
+	mux := App()
+	var jobIds []int
+	for _, c := range cases {
+		r, err := http.NewRequest("POST", "/galleries/"+c.galleryId+"/webhook",
+			bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set(signatureHeader, c.signature)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Fatalf("Status code should be %d rather than %d: %s", c.code,
+				w.Code, w.Body.String())
+		}
+		if w.Code == 202 {
+			var job Job
+			if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+				t.Fatal(err)
+			}
+			jobIds = append(jobIds, job.Id)
+		}
+	}
+	if jobIds[0] != jobIds[1] {
+		t.Fatalf("Requests should be deduplicated: %v", jobIds)
+	}
+
+	token, err := IssueToken(galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := "/galleries/" + galleryId + "/jobs"
+	for _, token := range []string{"", "invalid"} {
+		if w := writeRequest(mux, "GET", jobs, token, ""); w.Code != 401 {
+			t.Fatalf("Jobs should need the token rather than %d", w.Code)
+		}
+	}
+	w := writeRequest(mux, "GET", jobs, token, "")
+	if w.Code != 200 {
+		t.Fatalf("Status code should be 200 rather than %d: %s", w.Code,
+			w.Body.String())
+	}
+	var list struct {
+		Results []Job `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Results) == 0 {
+		t.Fatal("The queued job should be listed")
+	}
+	for _, job := range list.Results {
+		if job.GalleryId != galleryId {
+			t.Fatalf("Jobs of another gallery should not be listed: %v", job)
+		}
+	}
+}
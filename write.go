@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxWriteBytes is the maximum size of a request body of the write API.
+const maxWriteBytes = 1 << 20
+
+// FieldError is a validation error of a field of a request body. Field is
+// empty if the error is not of a field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrorRegexp matches validation messages such as
+// "Invalid open_at: 25:00 should be like 10:00".
+var fieldErrorRegexp = regexp.MustCompile(`^Invalid ([A-Za-z_]+): (.*)$`)
+
+// fieldErrors splits validation messages into errors of fields.
+func fieldErrors(err ValidationError) []*FieldError {
+	errs := make([]*FieldError, len(err))
+	for i, msg := range err {
+		if m := fieldErrorRegexp.FindStringSubmatch(msg); m != nil {
+			errs[i] = &FieldError{strings.ToLower(m[1]), m[2]}
+		} else {
+			errs[i] = &FieldError{Message: msg}
+		}
+	}
+	return errs
+}
+
+// JsonFieldErrors sends errors of fields as JSON with 400 status.
+func JsonFieldErrors(w http.ResponseWriter, err ValidationError) {
+	JsonStatus(w, http.StatusBadRequest, &ListResponse{
+		Errors: fieldErrors(err), Code: http.StatusBadRequest})
+}
+
+// JsonConflict sends an error of id that already exists with 409 status.
+func JsonConflict(w http.ResponseWriter, id string) {
+	JsonStatus(w, http.StatusConflict, &ListResponse{
+		Errors: []*FieldError{{"id", id + " already exists"}},
+		Code:   http.StatusConflict})
+}
+
+// authorize returns an UnauthorizedError unless r has the token of the
+// gallery.
+func authorize(r *http.Request, galleryId string) error {
+	ok, err := VerifyToken(galleryId, bearerToken(r))
+	if err != nil {
+		return err
+	} else if !ok {
+		return &UnauthorizedError{}
+	}
+	return nil
+}
+
+// decodeBody decodes a JSON request body up to maxWriteBytes into v. Errors
+// are returned as a ValidationError.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) ValidationError {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWriteBytes))
+	if err != nil {
+		return ValidationError{"Invalid body: " + err.Error()}
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return ValidationError{"Invalid body: " + err.Error()}
+	}
+	return nil
+}
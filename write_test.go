@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldErrors(t *testing.T) {
+	errs := fieldErrors(ValidationError{
+		"Invalid Id: 1 is not an UUID",
+		"Invalid open_at: 10:00 should be before close_at 09:00",
+		"Duplicate id 2014-1 in 2014.csv and 2015.csv",
+	})
+	expected := []*FieldError{
+		{"id", "1 is not an UUID"},
+		{"open_at", "10:00 should be before close_at 09:00"},
+		{"", "Duplicate id 2014-1 in 2014.csv and 2015.csv"},
+	}
+	if !reflect.DeepEqual(expected, errs) {
+		t.Fatalf("Expected %v. But got %v instead", expected, errs)
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	e := &Exhibition{Title: "新春彫刻展",
+		DateRange: *MustParseDateRange("2014-01-14", "2014-01-20")}
+	if err := validateContent(e); err != nil {
+		t.Fatal(err)
+	}
+	e.DateRange[1] = e.DateRange[0].AddDate(0, 0, -1)
+	e.Title = " "
+	if err := validateContent(e); len(err) != 2 {
+		t.Fatalf("Title and date_range should be invalid: %v", err)
+	}
+	e = &Exhibition{Title: "常設展"}
+	if err := validateContent(e); len(err) != 1 {
+		t.Fatalf("Start should be required: %v", err)
+	}
+}
+
+// writeRequest sends a request with a JSON body and the token to mux.
+func writeRequest(mux http.Handler, method, urlStr, token, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, urlStr, bytes.NewBufferString(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestWriteRoutes(t *testing.T) {
+	if err := OpenTestDb(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	MustTruncateAll()
+
+	galleryId := "b9fe1506-30c4-4cff-b73e-99d859199a6d"
+	token, err := IssueToken(galleryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := IssueToken("6ba7b814-9dad-11d1-80b4-00c04fd430c8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gallery := "/galleries/" + galleryId
+	exhibition := gallery + "/exhibitions/2014-1"
+	sameStart := gallery + "/exhibitions/2014-3"
+
+	cases := []struct {
+		method string
+		url    string
+		token  string
+		body   string
+		code   int
+	}{
+		{"POST", gallery, "", `{"name": "ヒラマ画廊"}`, 401},
+		{"POST", gallery, otherToken, `{"name": "ヒラマ画廊"}`, 401},
+		{"POST", exhibition, token, `{"title": "新春彫刻展",
+			"date_range": ["2014-01-14", "2014-01-20"]}`, 404},
+		{"POST", gallery, token, `{"name": "ヒラマ画廊",
+			"opening_hours": {"open_at": "18:00", "close_at": "10:00"}}`, 400},
+		{"POST", gallery, token, `{"name": "ヒラマ画廊"`, 400},
+		{"POST", gallery, token, `{"name": "ヒラマ画廊",
+			"opening_hours": {"open_at": "10:00", "close_at": "18:00"}}`, 201},
+		{"POST", gallery, token, `{"name": "ヒラマ画廊"}`, 409},
+		{"PATCH", gallery, token, `{"about": "About"}`, 200},
+		{"PUT", gallery, token, `{"id": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+			"name": "ヒラマ画廊"}`, 400},
+		{"POST", exhibition, token, `{"title": ""}`, 400},
+		{"POST", exhibition, token, `{"title": "新年おめでとう展",
+			"date_range": ["2014-01-05", "2014-01-13"]}`, 201},
+		{"PATCH", exhibition, token, `{"note": "closed on Monday"}`, 200},
+		{"PUT", gallery + "/exhibitions/2014-2", token, `{"title": "新春彫刻展",
+			"date_range": ["2014-01-14", "2014-01-20"]}`, 201},
+		// another exhibition starts on the same day
+		{"POST", sameStart, token, `{"title": "光彩画廊コレクション展",
+			"date_range": ["2014-01-14", "2014-01-27"]}`, 400},
+		{"PATCH", exhibition, token, `{"date_range": ["2014-01-14", null]}`, 400},
+		{"DELETE", exhibition, token, ``, 204},
+		{"DELETE", exhibition, token, ``, 404},
+		{"DELETE", gallery, token, ``, 204},
+	}
+	mux := App()
+	for _, c := range cases {
+		w := writeRequest(mux, c.method, c.url, c.token, c.body)
+		if w.Code != c.code {
+			t.Fatalf("%s %s %s: Status code should be %d rather than %d: %s",
+				c.method, c.url, c.body, c.code, w.Code, w.Body.String())
+		}
+		if c.url == sameStart && !strings.Contains(w.Body.String(), `"field":"start"`) {
+			t.Fatalf("It should be an error of start: %s", w.Body.String())
+		}
+		if c.method == "PATCH" && c.url == gallery {
+			var g Gallery
+			if err := json.Unmarshal(w.Body.Bytes(), &g); err != nil {
+				t.Fatal(err)
+			}
+			if g.About != "About" || g.Hours.OpenAt != "10:00" {
+				t.Fatalf("Only about should be updated: %v", g)
+			}
+		}
+	}
+	if g, err := GetGallery(galleryId); err != nil || g != nil {
+		t.Fatalf("Gallery should be deleted: %v %v", g, err)
+	}
+	if ok, err := VerifyToken(galleryId, token); err != nil || ok {
+		t.Fatalf("The token of the gallery should be deleted: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Epochs of serial dates of Excel. 1899-12-30 compensates for the leap day of
+// 1900 that doesn't exist.
+var (
+	excelEpoch     = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	excelEpoch1904 = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		Id   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxText is a plain or rich text. Phonetic runs are ignored.
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *xlsxText) String() string {
+	s := t.T
+	for _, r := range t.R {
+		s += r.T
+	}
+	return s
+}
+
+type xlsxStyleSheet struct {
+	NumFmts []struct {
+		Id   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtId int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string   `xml:"r,attr"`
+			S  int      `xml:"s,attr"`
+			T  string   `xml:"t,attr"`
+			V  string   `xml:"v"`
+			Is xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// xlsxFile is an opened workbook.
+type xlsxFile struct {
+	files    map[string]*zip.File
+	workbook xlsxWorkbook
+	rels     map[string]string
+	strings  []string
+	dates    []bool
+}
+
+func openXLSX(b []byte) (*xlsxFile, error) {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid xlsx file: %s", err.Error())
+	}
+	x := &xlsxFile{files: make(map[string]*zip.File), rels: make(map[string]string)}
+	for _, f := range r.File {
+		x.files[f.Name] = f
+	}
+	if err := x.decode("xl/workbook.xml", &x.workbook, true); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := x.decode("xl/_rels/workbook.xml.rels", &rels, true); err != nil {
+		return nil, err
+	}
+	for _, rel := range rels.Relationships {
+		// targets are relative to xl/ or absolute in the package
+		if strings.HasPrefix(rel.Target, "/") {
+			x.rels[rel.Id] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			x.rels[rel.Id] = path.Join("xl", rel.Target)
+		}
+	}
+	var sst xlsxSharedStrings
+	if err := x.decode("xl/sharedStrings.xml", &sst, false); err != nil {
+		return nil, err
+	}
+	for i := range sst.Items {
+		x.strings = append(x.strings, sst.Items[i].String())
+	}
+	var styles xlsxStyleSheet
+	if err := x.decode("xl/styles.xml", &styles, false); err != nil {
+		return nil, err
+	}
+	codes := make(map[int]string)
+	for _, f := range styles.NumFmts {
+		codes[f.Id] = f.Code
+	}
+	for _, xf := range styles.CellXfs {
+		code, ok := codes[xf.NumFmtId]
+		x.dates = append(x.dates, (ok && isDateFormatCode(code)) ||
+			(!ok && isDateFormatId(xf.NumFmtId)))
+	}
+	return x, nil
+}
+
+// decode decodes an XML part of the package.
+func (x *xlsxFile) decode(name string, v interface{}, required bool) error {
+	f, ok := x.files[name]
+	if !ok {
+		if required {
+			return fmt.Errorf("Invalid xlsx file: %s is missing", name)
+		}
+		return nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("Invalid xlsx file: %s: %s", name, err.Error())
+	}
+	return nil
+}
+
+// isDateFormatId reports whether a built-in number format is a date. 27 to
+// 36 and 50 to 58 are dates of Japanese and other East Asian locales.
+func isDateFormatId(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 27 && id <= 36) ||
+		(id >= 45 && id <= 47) || (id >= 50 && id <= 58)
+}
+
+// isDateFormatCode reports whether a custom number format code has tokens of
+// dates. Quoted strings, escaped characters and brackets are ignored.
+func isDateFormatCode(code string) bool {
+	quoted, bracket, escaped := false, false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '[':
+			bracket = true
+		case r == ']':
+			bracket = false
+		case bracket:
+		case r == 'y' || r == 'd':
+			return true
+		}
+	}
+	return false
+}
+
+// sheetPath returns the path of the named sheet, or the first sheet if name
+// is empty.
+func (x *xlsxFile) sheetPath(name string) (string, error) {
+	names := []string{}
+	for _, s := range x.workbook.Sheets {
+		if name == "" || s.Name == name {
+			if p, ok := x.rels[s.Id]; ok {
+				return p, nil
+			}
+			return "", fmt.Errorf("Invalid xlsx file: sheet %s is missing", s.Name)
+		}
+		names = append(names, s.Name)
+	}
+	if name == "" {
+		return "", fmt.Errorf("Invalid xlsx file: no sheet")
+	}
+	return "", fmt.Errorf("Sheet %s is not found. Sheets are %s", name,
+		strings.Join(names, ", "))
+}
+
+// serialDate converts a serial date into a time.
+func (x *xlsxFile) serialDate(v float64) time.Time {
+	epoch := excelEpoch
+	if x.workbook.Properties.Date1904 {
+		epoch = excelEpoch1904
+	}
+	seconds := math.Floor(v*86400 + 0.5)
+	return epoch.Add(time.Duration(seconds) * time.Second)
+}
+
+// cellValue returns the value of a cell as a string like a CSV field. Dates
+// are formatted in DATE_LAYOUT_SLASH.
+func (x *xlsxFile) cellValue(t, v string, style int, is *xlsxText) string {
+	switch t {
+	case "s":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return ""
+		}
+		return x.strings[i]
+	case "inlineStr":
+		return is.String()
+	case "str", "e":
+		return v
+	case "b":
+		if v == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "d":
+		// ISO 8601 date
+		if len(v) < len(DATE_LAYOUT) {
+			return v
+		}
+		if d, err := time.Parse(DATE_LAYOUT, v[:len(DATE_LAYOUT)]); err == nil {
+			return d.Format(DATE_LAYOUT_SLASH)
+		}
+		return v
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	if style >= 0 && style < len(x.dates) && x.dates[style] {
+		return x.serialDate(f).Format(DATE_LAYOUT_SLASH)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// xlsxMaxColumns is the number of columns of a sheet. The last column is XFD.
+const xlsxMaxColumns = 16384
+
+// cellColumn returns the zero based column of a cell reference like "AB12".
+// It is xlsxMaxColumns or more if the column is beyond the last column.
+func cellColumn(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' || col > xlsxMaxColumns {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return col - 1
+}
+
+// decodeXLSX decodes a sheet of an Excel workbook. The first sheet is decoded
+// if sheet is empty. The first non-empty row is the header, and empty rows
+// are skipped. Lines and columns of the table are rows and columns of the
+// sheet.
+func decodeXLSX(file, sheet string, b []byte) (*exhibitionTable, error) {
+	var ws xlsxWorksheet
+	x, err := openXLSX(b)
+	if err == nil {
+		var name string
+		if name, err = x.sheetPath(sheet); err == nil {
+			err = x.decode(name, &ws, true)
+		}
+	}
+	if err != nil {
+		return nil, ParseErrors{}.Append(file, 0, 0, err.Error())
+	}
+
+	t := &exhibitionTable{HasColumns: true}
+	for i, row := range ws.Rows {
+		line := row.R
+		if line == 0 {
+			line = i + 1
+		}
+		values := []string{}
+		empty := true
+		for j, c := range row.Cells {
+			col := j
+			if c.R != "" {
+				col = cellColumn(c.R)
+			}
+			if col < 0 {
+				continue
+			}
+			if col >= xlsxMaxColumns {
+				if sheet == "" && len(x.workbook.Sheets) != 0 {
+					sheet = x.workbook.Sheets[0].Name
+				}
+				return nil, ParseErrors{}.Append(file, line, 0, fmt.Sprintf(
+					"Invalid xlsx file: cell %s of sheet %s is beyond the "+
+						"last column XFD", c.R, sheet))
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+			values[col] = x.cellValue(c.T, c.V, c.S, &c.Is)
+			if strings.TrimSpace(values[col]) != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+		if t.Header == nil {
+			t.Header, t.HeaderLine = values, line
+			continue
+		}
+		for len(values) < len(t.Header) {
+			values = append(values, "")
+		}
+		t.Rows = append(t.Rows, exhibitionRow{line, values})
+	}
+	if t.Header == nil {
+		return nil, NoContentError
+	}
+	return t, nil
+}
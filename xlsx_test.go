@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustXLSX makes a workbook of two sheets. The first sheet has exhibitions
+// with dates as serial numbers, and "2013" has dates as strings. Parts are
+// replaced by replaces.
+func mustXLSX(replaces map[string]string) []byte {
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="2014" sheetId="1" r:id="rId1"/><sheet name="2013" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>id</t></si>
+<si><t>タイトル:title</t></si>
+<si><t>開始日:start</t></si>
+<si><t>最終日:end</t></si>
+<si><t>新年おめでとう展【後期】</t><rPh sb="0" eb="2"><t>シンネン</t></rPh></si>
+<si><r><t>新春</t></r><r><rPr><b/></rPr><t>彫刻展</t></r></si>
+<si><t>2014-1</t></si>
+<si><t>2013/12/01</t></si>
+<si><t>2013/12/25</t></si>
+</sst>`,
+		"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="176" formatCode="yyyy/mm/dd;@"/></numFmts>
+<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="176"/></cellXfs>
+</styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c></row>
+<row r="2"><c r="A2" t="s"><v>6</v></c><c r="B2" t="s"><v>4</v></c><c r="C2" s="1"><v>41644</v></c><c r="D2" s="2"><v>41652</v></c></row>
+<row r="3"><c r="A3" s="2"/></row>
+<row r="4"><c r="A4"><v>2014</v></c><c r="B4" t="s"><v>5</v></c><c r="C4" s="2"><v>41653.5</v></c><c r="D4" t="inlineStr"><is><t>2014/01/20</t></is></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="2"><c r="B2" t="s"><v>0</v></c><c r="C2" t="s"><v>1</v></c><c r="D2" t="s"><v>2</v></c><c r="E2" t="s"><v>3</v></c></row>
+<row r="3"><c r="B3"><v>2013</v></c><c r="C3" t="s"><v>4</v></c><c r="D3" t="s"><v>7</v></c><c r="E3" t="s"><v>3</v></c></row>
+</sheetData></worksheet>`,
+	}
+	for name, content := range replaces {
+		parts[name] = content
+	}
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			panic(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseExhibitionFileXLSX(t *testing.T) {
+	galleryId := "B9FE1506-30C4-4CFF-B73E-99D859199A6D"
+	csv := `id,title,start,end
+2014-1,新年おめでとう展【後期】,2014/01/05,2014/01/13
+2014,新春彫刻展,2014/01/14,2014/01/20
+`
+	expected, err := ParseExhibitionCSV(galleryId, "2014.xlsx",
+		bytes.NewReader([]byte(csv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := mustXLSX(nil)
+	exhibitions, err := parseExhibitionFile(galleryId,
+		ExhibitionFile{Name: "2014.xlsx"}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, exhibitions) {
+		t.Fatalf("Expected %v\n. But got %v instead", expected, exhibitions)
+	}
+
+	_, err = parseExhibitionFile(galleryId,
+		ExhibitionFile{Name: "2014.xlsx", Sheet: "2013"}, b)
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("It should return a ParseError. But got %v", err)
+	}
+	if msg := errs[0].Error(); msg != "2014.xlsx:3:5: Invalid end date: 最終日:end" {
+		t.Fatalf("Unexpected error %s", msg)
+	}
+
+	_, err = parseExhibitionFile(galleryId,
+		ExhibitionFile{Name: "2014.xlsx", Sheet: "2015"}, b)
+	if err == nil || err.Error() != "Validation Error:\n2014.xlsx: Sheet 2015 is not found. Sheets are 2014, 2013" {
+		t.Fatalf("It should return an error of a missing sheet. But got %v", err)
+	}
+}
+
+func TestCellColumn(t *testing.T) {
+	for ref, col := range map[string]int{
+		"A1":   0,
+		"AB12": 27,
+		"XFD1": 16383,
+		"XFE1": 16384,
+		"1":    -1,
+	} {
+		if c := cellColumn(ref); c != col {
+			t.Fatalf("Column of %s should be %d rather than %d", ref, col, c)
+		}
+	}
+	if c := cellColumn("ZZZZZZZZZZZZZZZZZZZZ1"); c < xlsxMaxColumns {
+		t.Fatalf("A long column should be beyond the last column: %d", c)
+	}
+
+	b := mustXLSX(map[string]string{
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="ZZZZZZZZZZ1" t="s"><v>1</v></c></row>
+</sheetData></worksheet>`,
+	})
+	_, err := parseExhibitionFile("B9FE1506-30C4-4CFF-B73E-99D859199A6D",
+		ExhibitionFile{Name: "2014.xlsx"}, b)
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 1 || errs[0].Line != 1 ||
+		!strings.Contains(errs[0].Error(), "ZZZZZZZZZZ1 of sheet 2014") {
+		t.Fatalf("A cell beyond the last column should be an error: %v", err)
+	}
+}
+
+func TestIsDateFormatCode(t *testing.T) {
+	cases := map[string]bool{
+		"yyyy/mm/dd;@":            true,
+		"[$-411]ge.m.d":           true,
+		`m"月"d"日"`:                true,
+		"0.00":                    false,
+		`#,##0"days"`:             false,
+		"[Red][<=100]0;[Blue]0.0": false,
+		"h:mm:ss":                 false,
+	}
+	for code, expected := range cases {
+		if isDateFormatCode(code) != expected {
+			t.Fatalf("%s: Expected %v", code, expected)
+		}
+	}
+}